@@ -3,12 +3,14 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/jackc/pgx/v5"
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -193,6 +195,14 @@ func handleLogin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if reason, err := accountRestriction(ctx, id); err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to check account")
+		return
+	} else if reason != "" {
+		writeError(w, http.StatusForbidden, reason)
+		return
+	}
+
 	token, err := createJWT(id)
 	if err != nil {
 		writeError(w, http.StatusInternalServerError, "Failed to create token")
@@ -361,6 +371,7 @@ func handleUpdateBasicInfo(w http.ResponseWriter, r *http.Request) {
 		writeError(w, http.StatusNotFound, "user not found")
 		return
 	}
+	markCandidateQueuesStale(ctx, userID)
 
 	writeJSON(w, http.StatusOK, map[string]string{
 		"status": "ok",
@@ -467,7 +478,25 @@ func handleUpdateMyBio(w http.ResponseWriter, r *http.Request) {
 	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
 	defer cancel()
 
-	_, err := db.Exec(ctx, `
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to start transaction")
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	// старая версия — чтобы понять, заметно ли поменялась анкета
+	var old bioSnapshot
+	err = tx.QueryRow(ctx, `
+		SELECT "aboutMe","goals","hobbies" FROM "Bio" WHERE "userId" = $1 FOR UPDATE
+	`, userID).Scan(&old.aboutMe, &old.goals, &old.hobbies)
+	hadBio := err == nil
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		writeError(w, http.StatusInternalServerError, "Failed to load bio")
+		return
+	}
+
+	_, err = tx.Exec(ctx, `
 		INSERT INTO "Bio" ("userId","aboutMe","hobbies","goals","languages")
 		VALUES ($1,$2,$3,$4,$5)
 		ON CONFLICT ("userId") DO UPDATE SET
@@ -480,6 +509,23 @@ func handleUpdateMyBio(w http.ResponseWriter, r *http.Request) {
 		writeError(w, http.StatusInternalServerError, "Failed to upsert bio")
 		return
 	}
+	// частоты слов для текстовой похожести — в той же транзакции, что и сам текст
+	if err := indexBioTerms(ctx, tx, userID); err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to index bio")
+		return
+	}
+	cur := bioSnapshot{aboutMe: body.AboutMe, goals: body.Goals, hobbies: body.Hobbies}
+	if hadBio && bioChangedSignificantly(old, cur) {
+		if err := markProfileChanged(ctx, tx, userID); err != nil {
+			writeError(w, http.StatusInternalServerError, "Failed to upsert bio")
+			return
+		}
+	}
+	if err := tx.Commit(ctx); err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to upsert bio")
+		return
+	}
+	markCandidateQueuesStale(ctx, userID)
 
 	writeJSON(w, http.StatusOK, map[string]interface{}{
 		"id": userID,
@@ -498,6 +544,7 @@ type updateProfileRequest struct {
 	Location  *string  `json:"location"`
 	Latitude  *float64 `json:"latitude"`
 	Longitude *float64 `json:"longitude"`
+	Timezone  *string  `json:"timezone"` // IANA, напр. "Europe/Helsinki"; опционально
 }
 
 func handleGetMyProfile(w http.ResponseWriter, r *http.Request) {
@@ -513,12 +560,13 @@ func handleGetMyProfile(w http.ResponseWriter, r *http.Request) {
 	var location *string
 	var lat, lon *float64
 	var superLikes int
+	var timezone string
 
 	err := db.QueryRow(ctx, `
-		SELECT "location","latitude","longitude","superLikes"
+		SELECT "location","latitude","longitude","superLikes","timezone"
 		FROM "Profile"
 		WHERE "userId" = $1
-	`, userID).Scan(&location, &lat, &lon, &superLikes)
+	`, userID).Scan(&location, &lat, &lon, &superLikes, &timezone)
 	if err != nil {
 		writeJSON(w, http.StatusOK, map[string]interface{}{
 			"id": userID,
@@ -527,6 +575,7 @@ func handleGetMyProfile(w http.ResponseWriter, r *http.Request) {
 				"latitude":   nil,
 				"longitude":  nil,
 				"superLikes": 0,
+				"timezone":   "UTC",
 			},
 		})
 		return
@@ -539,6 +588,7 @@ func handleGetMyProfile(w http.ResponseWriter, r *http.Request) {
 			"latitude":   lat,
 			"longitude":  lon,
 			"superLikes": superLikes,
+			"timezone":   timezone,
 		},
 	})
 }
@@ -556,21 +606,45 @@ func handleUpdateMyProfile(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if body.Timezone != nil {
+		tz := strings.TrimSpace(*body.Timezone)
+		if _, err := time.LoadLocation(tz); err != nil || tz == "" || strings.EqualFold(tz, "Local") {
+			writeError(w, http.StatusBadRequest, "Invalid timezone, expected IANA name like Europe/Helsinki")
+			return
+		}
+		body.Timezone = &tz
+	}
+
 	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
 	defer cancel()
 
-	_, err := db.Exec(ctx, `
-		INSERT INTO "Profile" ("userId","location","latitude","longitude","superLikes")
-		VALUES ($1,$2,$3,$4,0)
+	var oldLat, oldLon *float64
+	err := db.QueryRow(ctx, `
+		SELECT "latitude","longitude" FROM "Profile" WHERE "userId" = $1
+	`, userID).Scan(&oldLat, &oldLon)
+	hadProfile := err == nil
+
+	// часовой пояс не трогаем, если его не прислали
+	var superLikes int
+	var timezone string
+	err = db.QueryRow(ctx, `
+		INSERT INTO "Profile" ("userId","location","latitude","longitude","superLikes","timezone")
+		VALUES ($1,$2,$3,$4,0,COALESCE($5,'UTC'))
 		ON CONFLICT ("userId") DO UPDATE SET
 			"location"=EXCLUDED."location",
 			"latitude"=EXCLUDED."latitude",
-			"longitude"=EXCLUDED."longitude"
-	`, userID, body.Location, body.Latitude, body.Longitude)
+			"longitude"=EXCLUDED."longitude",
+			"timezone"=COALESCE($5,"Profile"."timezone")
+		RETURNING "superLikes","timezone"
+	`, userID, body.Location, body.Latitude, body.Longitude, body.Timezone).Scan(&superLikes, &timezone)
 	if err != nil {
 		writeError(w, http.StatusInternalServerError, "Failed to upsert profile")
 		return
 	}
+	if hadProfile && locationChangedSignificantly(oldLat, oldLon, body.Latitude, body.Longitude) {
+		_ = markProfileChanged(ctx, db, userID)
+	}
+	markCandidateQueuesStale(ctx, userID)
 
 	writeJSON(w, http.StatusOK, map[string]interface{}{
 		"id": userID,
@@ -578,7 +652,8 @@ func handleUpdateMyProfile(w http.ResponseWriter, r *http.Request) {
 			"location":   body.Location,
 			"latitude":   body.Latitude,
 			"longitude":  body.Longitude,
-			"superLikes": 0,
+			"superLikes": superLikes,
+			"timezone":   timezone,
 		},
 	})
 }
@@ -590,6 +665,8 @@ type updatePreferencesRequest struct {
 	AgeMin          *int   `json:"ageMin"`
 	AgeMax          *int   `json:"ageMax"`
 	MaxDistanceKm   *int   `json:"maxDistanceKm"`
+	// показывать ли снова пропущенных, если они обновили анкету; nil — не менять
+	ResurfacePassed *bool `json:"resurfacePassed"`
 }
 
 func handleGetMyPreferences(w http.ResponseWriter, r *http.Request) {
@@ -604,12 +681,13 @@ func handleGetMyPreferences(w http.ResponseWriter, r *http.Request) {
 
 	var preferredSex *string
 	var ageMin, ageMax, maxDistanceKm *int
+	var resurfacePassed bool
 
 	err := db.QueryRow(ctx, `
-		SELECT "preferredSex","ageMin","ageMax","maxDistanceKm"
+		SELECT "preferredSex","ageMin","ageMax","maxDistanceKm","resurfacePassed"
 		FROM "Preferences"
 		WHERE "userId" = $1
-	`, userID).Scan(&preferredSex, &ageMin, &ageMax, &maxDistanceKm)
+	`, userID).Scan(&preferredSex, &ageMin, &ageMax, &maxDistanceKm, &resurfacePassed)
 	if err != nil || preferredSex == nil {
 		writeJSON(w, http.StatusOK, map[string]interface{}{
 			"id": userID,
@@ -618,6 +696,7 @@ func handleGetMyPreferences(w http.ResponseWriter, r *http.Request) {
 				"ageMin":          nil,
 				"ageMax":          nil,
 				"maxDistanceKm":   nil,
+				"resurfacePassed": true,
 			},
 		})
 		return
@@ -630,6 +709,7 @@ func handleGetMyPreferences(w http.ResponseWriter, r *http.Request) {
 			"ageMin":          ageMin,
 			"ageMax":          ageMax,
 			"maxDistanceKm":   maxDistanceKm,
+			"resurfacePassed": resurfacePassed,
 		},
 	})
 }
@@ -686,19 +766,23 @@ func handleUpdateMyPreferences(w http.ResponseWriter, r *http.Request) {
 	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
 	defer cancel()
 
-	_, err := db.Exec(ctx, `
-		INSERT INTO "Preferences" ("userId","preferredSex","ageMin","ageMax","maxDistanceKm")
-		VALUES ($1,$2,$3,$4,$5)
+	var resurfacePassed bool
+	err := db.QueryRow(ctx, `
+		INSERT INTO "Preferences" ("userId","preferredSex","ageMin","ageMax","maxDistanceKm","resurfacePassed")
+		VALUES ($1,$2,$3,$4,$5,COALESCE($6,TRUE))
 		ON CONFLICT ("userId") DO UPDATE SET
 			"preferredSex"=EXCLUDED."preferredSex",
 			"ageMin"=EXCLUDED."ageMin",
 			"ageMax"=EXCLUDED."ageMax",
-			"maxDistanceKm"=EXCLUDED."maxDistanceKm"
-	`, userID, pref, ageMinNum, ageMaxNum, body.MaxDistanceKm)
+			"maxDistanceKm"=EXCLUDED."maxDistanceKm",
+			"resurfacePassed"=COALESCE($6,"Preferences"."resurfacePassed")
+		RETURNING "resurfacePassed"
+	`, userID, pref, ageMinNum, ageMaxNum, body.MaxDistanceKm, body.ResurfacePassed).Scan(&resurfacePassed)
 	if err != nil {
 		writeError(w, http.StatusInternalServerError, "Failed to upsert preferences")
 		return
 	}
+	markCandidateQueuesStale(ctx, userID)
 
 	writeJSON(w, http.StatusOK, map[string]interface{}{
 		"id": userID,
@@ -707,6 +791,7 @@ func handleUpdateMyPreferences(w http.ResponseWriter, r *http.Request) {
 			"ageMin":          ageMinNum,
 			"ageMax":          ageMaxNum,
 			"maxDistanceKm":   body.MaxDistanceKm,
+			"resurfacePassed": resurfacePassed,
 		},
 	})
 }
@@ -748,6 +833,9 @@ func handleUploadPhoto(w http.ResponseWriter, r *http.Request) {
 		writeError(w, http.StatusInternalServerError, "Failed to create photo")
 		return
 	}
+	// новое фото — повод показать анкету тем, кто её пропустил
+	_ = markProfileChanged(ctx, db, userID)
+	markCandidateQueuesStale(ctx, userID)
 
 	writeJSON(w, http.StatusCreated, map[string]interface{}{
 		"id": userID,
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// ===== блокировки =====
+//
+// Блок действует в обе стороны: заблокированный и заблокировавший не видят
+// друг друга в рекомендациях, профилях и presence, не получают typing,
+// не могут писать друг другу и создавать чат. Коннекшены не трогаем,
+// чтобы после разблокировки всё вернулось как было.
+
+var errUserBlocked = errors.New("user is blocked")
+
+// isBlockedBetween — есть ли блок в любую сторону
+func isBlockedBetween(ctx context.Context, q dbtx, a, b int64) (bool, error) {
+	var blocked bool
+	err := q.QueryRow(ctx, `
+		SELECT EXISTS (
+			SELECT 1 FROM "Block"
+			WHERE ("blockerId" = $1 AND "blockedId" = $2)
+			   OR ("blockerId" = $2 AND "blockedId" = $1)
+		)
+	`, a, b).Scan(&blocked)
+	return blocked, err
+}
+
+// blockedWith — все, с кем у юзера блок в любую сторону
+func blockedWith(ctx context.Context, userID int64) (map[int64]bool, error) {
+	rows, err := db.Query(ctx, `
+		SELECT "blockedId" FROM "Block" WHERE "blockerId" = $1
+		UNION
+		SELECT "blockerId" FROM "Block" WHERE "blockedId" = $1
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	ids, err := pgx.CollectRows(rows, pgx.RowTo[int64])
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[int64]bool, len(ids))
+	for _, id := range ids {
+		out[id] = true
+	}
+	return out, nil
+}
+
+// POST /users/{id}/block
+func handleBlockUser(w http.ResponseWriter, r *http.Request) {
+	userID, ok := getUserIDFromContext(r)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "Authentication required")
+		return
+	}
+
+	targetID, ok := parseIDParam(r, "id")
+	if !ok {
+		writeError(w, http.StatusBadRequest, "Invalid user id")
+		return
+	}
+	if targetID == userID {
+		writeError(w, http.StatusBadRequest, "Cannot block yourself")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	var tmp int64
+	if err := db.QueryRow(ctx, `SELECT "id" FROM "User" WHERE "id" = $1`, targetID).Scan(&tmp); err != nil {
+		writeError(w, http.StatusNotFound, "User not found")
+		return
+	}
+
+	var blockedAt time.Time
+	err := db.QueryRow(ctx, `
+		INSERT INTO "Block" ("blockerId","blockedId")
+		VALUES ($1,$2)
+		ON CONFLICT ("blockerId","blockedId") DO UPDATE SET
+			"blockerId" = EXCLUDED."blockerId"
+		RETURNING "createdAt"
+	`, userID, targetID).Scan(&blockedAt)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to block user")
+		return
+	}
+	markRecommendationsStale(ctx, userID, targetID)
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"blockedUserId": targetID,
+		"blockedAt":     blockedAt,
+	})
+}
+
+// DELETE /users/{id}/block
+func handleUnblockUser(w http.ResponseWriter, r *http.Request) {
+	userID, ok := getUserIDFromContext(r)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "Authentication required")
+		return
+	}
+
+	targetID, ok := parseIDParam(r, "id")
+	if !ok {
+		writeError(w, http.StatusBadRequest, "Invalid user id")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	// снять можно только свой блок
+	res, err := db.Exec(ctx, `
+		DELETE FROM "Block"
+		WHERE "blockerId" = $1 AND "blockedId" = $2
+	`, userID, targetID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to unblock user")
+		return
+	}
+	if res.RowsAffected() == 0 {
+		writeError(w, http.StatusNotFound, "User is not blocked")
+		return
+	}
+	markRecommendationsStale(ctx, userID, targetID)
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"unblockedUserId": targetID,
+	})
+}
+
+type blockedUserResponse struct {
+	UserID    int64     `json:"userId"`
+	Name      string    `json:"name"`
+	AvatarURL *string   `json:"avatarUrl"`
+	BlockedAt time.Time `json:"blockedAt"`
+}
+
+// GET /me/blocks — кого заблокировал я
+func handleGetMyBlocks(w http.ResponseWriter, r *http.Request) {
+	userID, ok := getUserIDFromContext(r)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "Authentication required")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	rows, err := db.Query(ctx, `
+		SELECT u."id", u."name",
+		       (SELECT p."url" FROM "Photo" p WHERE p."userId" = u."id" ORDER BY p."id" LIMIT 1),
+		       b."createdAt"
+		FROM "Block" b
+		JOIN "User" u ON u."id" = b."blockedId"
+		WHERE b."blockerId" = $1
+		ORDER BY b."createdAt" DESC
+	`, userID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to load blocked users")
+		return
+	}
+	blocks, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (blockedUserResponse, error) {
+		var b blockedUserResponse
+		err := row.Scan(&b.UserID, &b.Name, &b.AvatarURL, &b.BlockedAt)
+		return b, err
+	})
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to scan blocked users")
+		return
+	}
+	if blocks == nil {
+		blocks = []blockedUserResponse{}
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"blocks": blocks,
+	})
+}
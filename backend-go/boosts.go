@@ -0,0 +1,217 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// ===== буст профиля =====
+//
+// Пока буст активен, профиль поднимается в чужих рекомендациях. Бонус
+// добавляется при выдаче, а не в очереди — буст короче интервала пересчёта.
+
+const scoreBoosted = 50.0
+
+var boostComponent = scoreComponent{
+	Kind:   "boost",
+	Label:  "boosted profile",
+	Points: scoreBoosted,
+}
+
+type boostResponse struct {
+	ID          int64     `json:"id"`
+	StartsAt    time.Time `json:"startsAt"`
+	EndsAt      time.Time `json:"endsAt"`
+	Active      bool      `json:"active"`
+	Impressions int       `json:"impressions"`
+	LikesGained int       `json:"likesGained"`
+}
+
+// POST /me/boosts
+func handleActivateBoost(w http.ResponseWriter, r *http.Request) {
+	userID, ok := getUserIDFromContext(r)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "Authentication required")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to start transaction")
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	// блокируем юзера, чтобы два запроса не включили два буста
+	var tmp int64
+	if err := tx.QueryRow(ctx, `SELECT "id" FROM "User" WHERE "id" = $1 FOR UPDATE`, userID).Scan(&tmp); err != nil {
+		writeError(w, http.StatusNotFound, "User not found")
+		return
+	}
+
+	var active bool
+	var usedThisWeek int
+	err = tx.QueryRow(ctx, `
+		SELECT
+			COALESCE(BOOL_OR("endsAt" > NOW()), FALSE),
+			COUNT(*) FILTER (WHERE "startsAt" > NOW() - INTERVAL '7 days')
+		FROM "Boost"
+		WHERE "userId" = $1
+	`, userID).Scan(&active, &usedThisWeek)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to check boosts")
+		return
+	}
+	if active {
+		writeError(w, http.StatusConflict, "A boost is already active")
+		return
+	}
+	weeklyLimit := limitsFor(ctx, userID).boostsWeekly
+	if usedThisWeek >= weeklyLimit {
+		writeError(w, http.StatusTooManyRequests, "Weekly boost limit reached")
+		return
+	}
+
+	var b boostResponse
+	err = tx.QueryRow(ctx, `
+		INSERT INTO "Boost" ("userId","startsAt","endsAt")
+		VALUES ($1, NOW(), NOW() + make_interval(secs => $2))
+		RETURNING "id","startsAt","endsAt"
+	`, userID, appConfig.BoostDuration.Seconds()).Scan(&b.ID, &b.StartsAt, &b.EndsAt)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to activate boost")
+		return
+	}
+	if err := tx.Commit(ctx); err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to activate boost")
+		return
+	}
+	b.Active = true
+
+	writeJSON(w, http.StatusCreated, map[string]interface{}{
+		"boost":           b,
+		"boostsRemaining": weeklyLimit - usedThisWeek - 1,
+	})
+}
+
+// GET /me/boosts — история бустов с аналитикой
+func handleGetMyBoosts(w http.ResponseWriter, r *http.Request) {
+	userID, ok := getUserIDFromContext(r)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "Authentication required")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	// лайки, полученные во время окна буста
+	rows, err := db.Query(ctx, `
+		SELECT b."id", b."startsAt", b."endsAt", b."endsAt" > NOW(), b."impressions",
+		       (
+				SELECT COUNT(*)
+				FROM "ConnectionSide" cs
+				WHERE cs."userId" = b."userId"
+				  AND cs."otherAction" IN ('LIKED','SUPERLIKED')
+				  AND cs."otherActedAt" >= b."startsAt"
+				  AND cs."otherActedAt" < b."endsAt"
+		       )
+		FROM "Boost" b
+		WHERE b."userId" = $1
+		ORDER BY b."startsAt" DESC
+		LIMIT 50
+	`, userID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to load boosts")
+		return
+	}
+	boosts, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (boostResponse, error) {
+		var b boostResponse
+		err := row.Scan(&b.ID, &b.StartsAt, &b.EndsAt, &b.Active, &b.Impressions, &b.LikesGained)
+		return b, err
+	})
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to scan boosts")
+		return
+	}
+
+	var usedThisWeek int
+	weekAgo := time.Now().Add(-7 * 24 * time.Hour)
+	for _, b := range boosts {
+		if b.StartsAt.After(weekAgo) {
+			usedThisWeek++
+		}
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"boosts":          boosts,
+		"boostsRemaining": max(limitsFor(ctx, userID).boostsWeekly-usedThisWeek, 0),
+	})
+}
+
+// applyActiveBoosts добавляет бонус кандидатам с активным бустом и пересортировывает.
+// Возвращает множество забущенных id.
+func applyActiveBoosts(ctx context.Context, results []scoredCandidate) (map[int64]bool, error) {
+	boosted := map[int64]bool{}
+	if len(results) == 0 {
+		return boosted, nil
+	}
+
+	ids := make([]int64, 0, len(results))
+	for _, c := range results {
+		ids = append(ids, c.id)
+	}
+	rows, err := db.Query(ctx, `
+		SELECT DISTINCT "userId"
+		FROM "Boost"
+		WHERE "userId" = ANY($1)
+		  AND "startsAt" <= NOW() AND "endsAt" > NOW()
+	`, ids)
+	if err != nil {
+		return nil, err
+	}
+	boostedIDs, err := pgx.CollectRows(rows, pgx.RowTo[int64])
+	if err != nil {
+		return nil, err
+	}
+	if len(boostedIDs) == 0 {
+		return boosted, nil
+	}
+
+	for _, id := range boostedIDs {
+		boosted[id] = true
+	}
+	for i := range results {
+		if boosted[results[i].id] {
+			results[i].score += scoreBoosted
+			if results[i].components != nil {
+				results[i].components = append(results[i].components, boostComponent)
+			}
+		}
+	}
+	sortScoredCandidates(results)
+	return boosted, nil
+}
+
+// recordBoostImpressions засчитывает показ карточек, у которых сейчас идёт буст
+func recordBoostImpressions(ctx context.Context, shownIDs []int64) {
+	if len(shownIDs) == 0 {
+		return
+	}
+	_, err := db.Exec(ctx, `
+		UPDATE "Boost"
+		SET "impressions" = "impressions" + 1
+		WHERE "userId" = ANY($1)
+		  AND "startsAt" <= NOW() AND "endsAt" > NOW()
+	`, shownIDs)
+	if err != nil {
+		log.Printf("recordBoostImpressions: %v", err)
+	}
+}
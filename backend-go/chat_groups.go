@@ -0,0 +1,679 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// ===== групповые чаты =====
+//
+// Группа — тот же "Chat" с kind = GROUP, названием и ролями в "ChatUser":
+// OWNER (один, создатель), ADMIN и MEMBER. Добавлять участников могут OWNER и
+// ADMIN, причём только тех, с кем у добавляющего матч (или он поддержка, или
+// CHAT_POLICY=open) и нет блока — суперлайка для группы мало. Политика и
+// закрытие при анматче относятся только к 1-1 чатам: в группе пишет любой
+// участник.
+
+const (
+	chatKindDirect = "DIRECT"
+	chatKindGroup  = "GROUP"
+
+	chatRoleOwner  = "OWNER"
+	chatRoleAdmin  = "ADMIN"
+	chatRoleMember = "MEMBER"
+
+	groupChatMaxMembers = 50
+	groupChatTitleMax   = 100
+)
+
+var (
+	errNotGroupAdmin      = errors.New("only the owner or an admin can do this")
+	errGroupChatFull      = errors.New("group chat is full")
+	errChatMemberNotFound = errors.New("user not found")
+)
+
+// chatRecipients — тип чата и все участники, кроме userID
+func chatRecipients(ctx context.Context, q dbtx, chatID, userID int64) (string, []int64, error) {
+	var kind string
+	var ids []int64
+	err := q.QueryRow(ctx, `
+		SELECT c."kind",
+		       COALESCE(array_agg(cu."userId") FILTER (WHERE cu."userId" <> $2), '{}')
+		FROM "Chat" c
+		LEFT JOIN "ChatUser" cu ON cu."chatId" = c."id"
+		WHERE c."id" = $1
+		GROUP BY c."id"
+	`, chatID, userID).Scan(&kind, &ids)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", nil, errChatNotFound
+	}
+	return kind, ids, err
+}
+
+// loadChatMembers — участники чатов: chatId -> список в порядке вступления
+func loadChatMembers(ctx context.Context, q dbtx, chatIDs []int64) (map[int64][]chatMemberResponse, error) {
+	rows, err := q.Query(ctx, `
+		SELECT cu."chatId", u."id", u."name",
+		       (SELECT p."url" FROM "Photo" p WHERE p."userId" = u."id" ORDER BY p."id" LIMIT 1),
+		       cu."role"
+		FROM "ChatUser" cu
+		JOIN "User" u ON u."id" = cu."userId"
+		WHERE cu."chatId" = ANY($1)
+		ORDER BY cu."chatId", cu."joinedAt", cu."id"
+	`, chatIDs)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := make(map[int64][]chatMemberResponse, len(chatIDs))
+	for rows.Next() {
+		var chatID int64
+		var m chatMemberResponse
+		if err := rows.Scan(&chatID, &m.UserID, &m.Name, &m.AvatarURL, &m.Role); err != nil {
+			return nil, err
+		}
+		out[chatID] = append(out[chatID], m)
+	}
+	return out, rows.Err()
+}
+
+func loadGroupMembers(ctx context.Context, q dbtx, chatID int64) ([]chatMemberResponse, error) {
+	members, err := loadChatMembers(ctx, q, []int64{chatID})
+	if err != nil {
+		return nil, err
+	}
+	if members[chatID] == nil {
+		return []chatMemberResponse{}, nil
+	}
+	return members[chatID], nil
+}
+
+// lockGroupMembership берёт лок на группу (изменения состава идут по одному)
+// и возвращает роль userID; errChatNotFound — не группа или юзер не участник
+func lockGroupMembership(ctx context.Context, q dbtx, chatID, userID int64) (string, error) {
+	var role string
+	err := q.QueryRow(ctx, `
+		SELECT cu."role"
+		FROM "Chat" c
+		JOIN "ChatUser" cu ON cu."chatId" = c."id" AND cu."userId" = $2
+		WHERE c."id" = $1 AND c."kind" = 'GROUP'
+		FOR UPDATE OF c
+	`, chatID, userID).Scan(&role)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", errChatNotFound
+	}
+	return role, err
+}
+
+func isGroupAdmin(role string) bool {
+	return role == chatRoleOwner || role == chatRoleAdmin
+}
+
+// checkCanAddMember — может ли adderID добавить memberID в группу
+func checkCanAddMember(ctx context.Context, q dbtx, adderID, memberID int64) error {
+	var tmp int64
+	if err := q.QueryRow(ctx, `SELECT "id" FROM "User" WHERE "id" = $1`, memberID).Scan(&tmp); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return errChatMemberNotFound
+		}
+		return err
+	}
+	blocked, err := isBlockedBetween(ctx, q, adderID, memberID)
+	if err != nil {
+		return err
+	}
+	if blocked {
+		// как и в остальных местах, блок маскируем под "нет такого"
+		return errChatMemberNotFound
+	}
+	return checkChatPolicy(ctx, q, chatActionAddMember, adderID, memberID, 0)
+}
+
+// addGroupMembers проверяет и добавляет участников, уже состоящих пропускает
+func addGroupMembers(ctx context.Context, q dbtx, chatID, adderID int64, userIDs []int64) error {
+	var count int
+	if err := q.QueryRow(ctx, `SELECT COUNT(*) FROM "ChatUser" WHERE "chatId" = $1`, chatID).Scan(&count); err != nil {
+		return err
+	}
+
+	var added []int64
+	for _, id := range userIDs {
+		var member bool
+		err := q.QueryRow(ctx, `
+			SELECT EXISTS(SELECT 1 FROM "ChatUser" WHERE "chatId" = $1 AND "userId" = $2)
+		`, chatID, id).Scan(&member)
+		if err != nil {
+			return err
+		}
+		if member {
+			continue
+		}
+		if err := checkCanAddMember(ctx, q, adderID, id); err != nil {
+			return err
+		}
+		added = append(added, id)
+	}
+	if count+len(added) > groupChatMaxMembers {
+		return errGroupChatFull
+	}
+
+	_, err := q.Exec(ctx, `
+		INSERT INTO "ChatUser" ("chatId","userId","role")
+		SELECT $1, unnest($2::bigint[]), 'MEMBER'
+		ON CONFLICT DO NOTHING
+	`, chatID, added)
+	return err
+}
+
+// parseMemberIDs — уникальные id без самого юзера
+func parseMemberIDs(userID int64, ids []int64) []int64 {
+	seen := map[int64]bool{userID: true}
+	out := make([]int64, 0, len(ids))
+	for _, id := range ids {
+		if id > 0 && !seen[id] {
+			seen[id] = true
+			out = append(out, id)
+		}
+	}
+	return out
+}
+
+func normalizeGroupTitle(raw string) (string, bool) {
+	title := strings.TrimSpace(raw)
+	return title, title != "" && utf8.RuneCountInString(title) <= groupChatTitleMax
+}
+
+// writeGroupChatError — ответы для ошибок групповых операций
+func writeGroupChatError(w http.ResponseWriter, err error, fallback string) {
+	switch {
+	case errors.Is(err, errChatNotFound):
+		writeError(w, http.StatusNotFound, "Chat not found")
+	case errors.Is(err, errChatMemberNotFound):
+		writeError(w, http.StatusNotFound, "User not found")
+	case errors.Is(err, errNotGroupAdmin):
+		writeError(w, http.StatusForbidden, "Only the owner or an admin can do this")
+	case errors.Is(err, errGroupChatFull):
+		writeError(w, http.StatusConflict, "Group chat is full")
+	case errors.Is(err, errChatNotAllowed), errors.Is(err, errMessageRequestUsed):
+		writeError(w, http.StatusForbidden, "You can only add your matches")
+	default:
+		writeError(w, http.StatusInternalServerError, fallback)
+	}
+}
+
+// notifyChatUpdated — участникам: состав или название группы изменились
+func notifyChatUpdated(ctx context.Context, chatID, actorID int64) {
+	_, members, err := chatRecipients(ctx, db, chatID, actorID)
+	if err != nil {
+		log.Printf("chat %d members: %v", chatID, err)
+		return
+	}
+	for _, id := range members {
+		wsSendToUser(id, wsOutgoing{Type: "chat_updated", ChatID: chatID, FromUserID: actorID})
+	}
+}
+
+func writeGroupChat(ctx context.Context, w http.ResponseWriter, status int, chatID int64) {
+	var title *string
+	if err := db.QueryRow(ctx, `SELECT "title" FROM "Chat" WHERE "id" = $1`, chatID).Scan(&title); err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to load chat")
+		return
+	}
+	members, err := loadGroupMembers(ctx, db, chatID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to load chat members")
+		return
+	}
+	writeJSON(w, status, map[string]interface{}{
+		"id":      chatID,
+		"kind":    chatKindGroup,
+		"title":   title,
+		"members": members,
+	})
+}
+
+// ===== POST /chats/groups =====
+
+func handleCreateGroupChat(w http.ResponseWriter, r *http.Request) {
+	userID, ok := getUserIDFromContext(r)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "Authentication required")
+		return
+	}
+
+	var body struct {
+		Title     string  `json:"title"`
+		MemberIDs []int64 `json:"memberIds"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid JSON")
+		return
+	}
+	title, ok := normalizeGroupTitle(body.Title)
+	if !ok {
+		writeError(w, http.StatusBadRequest, "Title must be 1-100 characters")
+		return
+	}
+	memberIDs := parseMemberIDs(userID, body.MemberIDs)
+	if len(memberIDs) == 0 {
+		writeError(w, http.StatusBadRequest, "memberIds must contain at least one other user")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to start transaction")
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	var chatID int64
+	err = tx.QueryRow(ctx, `
+		INSERT INTO "Chat" ("kind","title","createdById")
+		VALUES ('GROUP', $1, $2)
+		RETURNING "id"
+	`, title, userID).Scan(&chatID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to create chat")
+		return
+	}
+	_, err = tx.Exec(ctx, `
+		INSERT INTO "ChatUser" ("chatId","userId","role")
+		VALUES ($1, $2, 'OWNER')
+	`, chatID, userID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to create chat")
+		return
+	}
+	if err := addGroupMembers(ctx, tx, chatID, userID, memberIDs); err != nil {
+		writeGroupChatError(w, err, "Failed to add members")
+		return
+	}
+	if err := tx.Commit(ctx); err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to create chat")
+		return
+	}
+
+	notifyChatUpdated(ctx, chatID, userID)
+	writeGroupChat(ctx, w, http.StatusCreated, chatID)
+}
+
+// ===== PUT /chats/{id} — переименовать группу =====
+
+func handleUpdateGroupChat(w http.ResponseWriter, r *http.Request) {
+	userID, ok := getUserIDFromContext(r)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "Authentication required")
+		return
+	}
+	chatID, ok := parseIDParam(r, "id")
+	if !ok {
+		writeError(w, http.StatusBadRequest, "Invalid chat id")
+		return
+	}
+
+	var body struct {
+		Title string `json:"title"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid JSON")
+		return
+	}
+	title, ok := normalizeGroupTitle(body.Title)
+	if !ok {
+		writeError(w, http.StatusBadRequest, "Title must be 1-100 characters")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to start transaction")
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	role, err := lockGroupMembership(ctx, tx, chatID, userID)
+	if err == nil && !isGroupAdmin(role) {
+		err = errNotGroupAdmin
+	}
+	if err != nil {
+		writeGroupChatError(w, err, "Failed to load chat")
+		return
+	}
+	if _, err := tx.Exec(ctx, `UPDATE "Chat" SET "title" = $2 WHERE "id" = $1`, chatID, title); err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to update chat")
+		return
+	}
+	if err := tx.Commit(ctx); err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to update chat")
+		return
+	}
+
+	notifyChatUpdated(ctx, chatID, userID)
+	writeGroupChat(ctx, w, http.StatusOK, chatID)
+}
+
+// ===== GET /chats/{id}/members =====
+
+func handleGetChatMembers(w http.ResponseWriter, r *http.Request) {
+	userID, ok := getUserIDFromContext(r)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "Authentication required")
+		return
+	}
+	chatID, ok := parseIDParam(r, "id")
+	if !ok {
+		writeError(w, http.StatusBadRequest, "Invalid chat id")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	if _, err := chatAccess(ctx, db, chatID, userID); err != nil {
+		writeError(w, http.StatusNotFound, "Chat not found")
+		return
+	}
+	members, err := loadGroupMembers(ctx, db, chatID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to load chat members")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"members": members,
+	})
+}
+
+// ===== POST /chats/{id}/members =====
+
+func handleAddChatMembers(w http.ResponseWriter, r *http.Request) {
+	userID, ok := getUserIDFromContext(r)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "Authentication required")
+		return
+	}
+	chatID, ok := parseIDParam(r, "id")
+	if !ok {
+		writeError(w, http.StatusBadRequest, "Invalid chat id")
+		return
+	}
+
+	var body struct {
+		UserIDs []int64 `json:"userIds"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid JSON")
+		return
+	}
+	memberIDs := parseMemberIDs(userID, body.UserIDs)
+	if len(memberIDs) == 0 {
+		writeError(w, http.StatusBadRequest, "userIds is required")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to start transaction")
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	role, err := lockGroupMembership(ctx, tx, chatID, userID)
+	if err == nil && !isGroupAdmin(role) {
+		err = errNotGroupAdmin
+	}
+	if err == nil {
+		err = addGroupMembers(ctx, tx, chatID, userID, memberIDs)
+	}
+	if err != nil {
+		writeGroupChatError(w, err, "Failed to add members")
+		return
+	}
+	if err := tx.Commit(ctx); err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to add members")
+		return
+	}
+
+	notifyChatUpdated(ctx, chatID, userID)
+	writeGroupChat(ctx, w, http.StatusOK, chatID)
+}
+
+// ===== PUT /chats/{id}/members/{userId} — роль участника (только OWNER) =====
+
+func handleUpdateChatMember(w http.ResponseWriter, r *http.Request) {
+	userID, ok := getUserIDFromContext(r)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "Authentication required")
+		return
+	}
+	chatID, ok := parseIDParam(r, "id")
+	if !ok {
+		writeError(w, http.StatusBadRequest, "Invalid chat id")
+		return
+	}
+	memberID, ok := parseIDParam(r, "userId")
+	if !ok || memberID == userID {
+		writeError(w, http.StatusBadRequest, "Invalid user id")
+		return
+	}
+
+	var body struct {
+		Role string `json:"role"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid JSON")
+		return
+	}
+	newRole := strings.ToUpper(strings.TrimSpace(body.Role))
+	if newRole != chatRoleAdmin && newRole != chatRoleMember {
+		writeError(w, http.StatusBadRequest, "role must be ADMIN or MEMBER")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to start transaction")
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	role, err := lockGroupMembership(ctx, tx, chatID, userID)
+	if err != nil {
+		writeGroupChatError(w, err, "Failed to load chat")
+		return
+	}
+	if role != chatRoleOwner {
+		writeError(w, http.StatusForbidden, "Only the owner can change roles")
+		return
+	}
+	res, err := tx.Exec(ctx, `
+		UPDATE "ChatUser" SET "role" = $3
+		WHERE "chatId" = $1 AND "userId" = $2
+	`, chatID, memberID, newRole)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to update member")
+		return
+	}
+	if res.RowsAffected() == 0 {
+		writeError(w, http.StatusNotFound, "Member not found")
+		return
+	}
+	if err := tx.Commit(ctx); err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to update member")
+		return
+	}
+
+	notifyChatUpdated(ctx, chatID, userID)
+	writeGroupChat(ctx, w, http.StatusOK, chatID)
+}
+
+// ===== DELETE /chats/{id}/members/{userId} =====
+
+// OWNER удаляет кого угодно, ADMIN — только MEMBER; себя — через /leave
+func handleRemoveChatMember(w http.ResponseWriter, r *http.Request) {
+	userID, ok := getUserIDFromContext(r)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "Authentication required")
+		return
+	}
+	chatID, ok := parseIDParam(r, "id")
+	if !ok {
+		writeError(w, http.StatusBadRequest, "Invalid chat id")
+		return
+	}
+	memberID, ok := parseIDParam(r, "userId")
+	if !ok || memberID == userID {
+		writeError(w, http.StatusBadRequest, "Invalid user id")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to start transaction")
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	role, err := lockGroupMembership(ctx, tx, chatID, userID)
+	if err == nil && !isGroupAdmin(role) {
+		err = errNotGroupAdmin
+	}
+	if err != nil {
+		writeGroupChatError(w, err, "Failed to load chat")
+		return
+	}
+
+	var memberRole string
+	err = tx.QueryRow(ctx, `
+		SELECT "role" FROM "ChatUser" WHERE "chatId" = $1 AND "userId" = $2
+	`, chatID, memberID).Scan(&memberRole)
+	if errors.Is(err, pgx.ErrNoRows) {
+		writeError(w, http.StatusNotFound, "Member not found")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to load member")
+		return
+	}
+	if memberRole == chatRoleOwner || (role == chatRoleAdmin && memberRole != chatRoleMember) {
+		writeError(w, http.StatusForbidden, "You cannot remove this member")
+		return
+	}
+
+	if err := removeChatMember(ctx, tx, chatID, memberID); err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to remove member")
+		return
+	}
+	if err := tx.Commit(ctx); err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to remove member")
+		return
+	}
+
+	wsSendToUser(memberID, wsOutgoing{Type: "chat_removed", ChatID: chatID, FromUserID: userID})
+	notifyChatUpdated(ctx, chatID, userID)
+	writeGroupChat(ctx, w, http.StatusOK, chatID)
+}
+
+func removeChatMember(ctx context.Context, q dbtx, chatID, userID int64) error {
+	if _, err := q.Exec(ctx, `DELETE FROM "ChatUser" WHERE "chatId" = $1 AND "userId" = $2`, chatID, userID); err != nil {
+		return err
+	}
+	_, err := q.Exec(ctx, `DELETE FROM "ChatRead" WHERE "chatId" = $1 AND "userId" = $2`, chatID, userID)
+	return err
+}
+
+// ===== POST /chats/{id}/leave =====
+
+// Уходящий OWNER передаёт группу самому давнему ADMIN, иначе самому давнему
+// участнику; последний ушедший удаляет группу.
+func handleLeaveChat(w http.ResponseWriter, r *http.Request) {
+	userID, ok := getUserIDFromContext(r)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "Authentication required")
+		return
+	}
+	chatID, ok := parseIDParam(r, "id")
+	if !ok {
+		writeError(w, http.StatusBadRequest, "Invalid chat id")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to start transaction")
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	role, err := lockGroupMembership(ctx, tx, chatID, userID)
+	if err != nil {
+		writeGroupChatError(w, err, "Failed to load chat")
+		return
+	}
+	if err := removeChatMember(ctx, tx, chatID, userID); err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to leave chat")
+		return
+	}
+
+	var left int
+	if err := tx.QueryRow(ctx, `SELECT COUNT(*) FROM "ChatUser" WHERE "chatId" = $1`, chatID).Scan(&left); err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to leave chat")
+		return
+	}
+	switch {
+	case left == 0:
+		_, err = tx.Exec(ctx, `DELETE FROM "Chat" WHERE "id" = $1`, chatID)
+	case role == chatRoleOwner:
+		_, err = tx.Exec(ctx, `
+			UPDATE "ChatUser" SET "role" = 'OWNER'
+			WHERE "id" = (
+				SELECT "id" FROM "ChatUser"
+				WHERE "chatId" = $1
+				ORDER BY ("role" = 'ADMIN') DESC, "joinedAt", "id"
+				LIMIT 1
+			)
+		`, chatID)
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to leave chat")
+		return
+	}
+	if err := tx.Commit(ctx); err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to leave chat")
+		return
+	}
+
+	if left > 0 {
+		notifyChatUpdated(ctx, chatID, userID)
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"leftChatId": chatID,
+	})
+}
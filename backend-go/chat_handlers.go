@@ -3,6 +3,8 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"log"
 	"net/http"
 	"strconv"
 	"strings"
@@ -12,16 +14,30 @@ import (
 	"github.com/jackc/pgx/v5"
 )
 
+var errChatNotFound = errors.New("chat not found")
+
 // ===== TYPES =====
 
+type chatMemberResponse struct {
+	UserID    int64   `json:"userId"`
+	Name      string  `json:"name"`
+	AvatarURL *string `json:"avatarUrl"`
+	Role      string  `json:"role"`
+}
+
 type chatPreviewResponse struct {
-	ID          int64      `json:"id"`
-	OtherUser   *int64     `json:"otherUserId"`
-	UserName    string     `json:"userName"`
-	AvatarURL   *string    `json:"avatarUrl"`
-	LastMsg     string     `json:"lastMessage"`
-	LastTime    *time.Time `json:"lastTime"`
-	UnreadCount int64      `json:"unreadCount"`
+	ID          int64                `json:"id"`
+	Kind        string               `json:"kind"` // DIRECT / GROUP
+	Title       *string              `json:"title"`
+	OtherUser   *int64               `json:"otherUserId"` // только в DIRECT
+	UserName    string               `json:"userName"`    // DIRECT — имя собеседника, GROUP — название
+	AvatarURL   *string              `json:"avatarUrl"`
+	LastMsg     string               `json:"lastMessage"`
+	LastTime    *time.Time           `json:"lastTime"`
+	UnreadCount int64                `json:"unreadCount"`
+	Closed      bool                 `json:"closed"` // матч разорван, писать нельзя
+	MyRole      string               `json:"myRole"`
+	Members     []chatMemberResponse `json:"members"`
 }
 
 type chatMessageResponse struct {
@@ -30,6 +46,7 @@ type chatMessageResponse struct {
 	SenderID  int64     `json:"senderId"`
 	Content   string    `json:"content"`
 	Timestamp time.Time `json:"timestamp"`
+	ClientID  *string   `json:"clientId,omitempty"`
 }
 
 // ===== GET /chats =====
@@ -47,9 +64,9 @@ func handleGetChats(w http.ResponseWriter, r *http.Request) {
 	rows, err := db.Query(ctx, `
 		SELECT
 			c."id" AS chatId,
-			u2."id" AS otherUserId,
-			u2."name" AS otherUserName,
-			p."url" AS avatarUrl,
+			c."kind",
+			c."title",
+			cu1."role",
 			m2."content" AS lastMessage,
 			m2."timestamp" AS lastTime,
 			COALESCE((
@@ -61,13 +78,11 @@ func handleGetChats(w http.ResponseWriter, r *http.Request) {
 				WHERE m3."chatId" = c."id"
 				  AND m3."timestamp" > COALESCE(cr."lastReadAt", '1970-01-01'::timestamp)
 				  AND m3."senderId" <> $1
-			), 0) AS unreadCount
+			), 0) AS unreadCount,
+			c."closedAt" IS NOT NULL AS closed
 		FROM "Chat" c
 		JOIN "ChatUser" cu1
-			ON cu1."chatId" = c."id" AND cu1."userId" = $1
-		JOIN "ChatUser" cu2
-			ON cu2."chatId" = c."id" AND cu2."userId" <> $1
-		JOIN "User" u2 ON u2."id" = cu2."userId"
+			ON cu1."chatId" = c."id" AND cu1."userId" = $1 AND cu1."hiddenAt" IS NULL
 		LEFT JOIN LATERAL (
 			SELECT "content", "timestamp"
 			FROM "Message"
@@ -75,8 +90,6 @@ func handleGetChats(w http.ResponseWriter, r *http.Request) {
 			ORDER BY "timestamp" DESC
 			LIMIT 1
 		) m2 ON TRUE
-		LEFT JOIN "Photo" p
-			ON p."userId" = u2."id"
 		ORDER BY m2."timestamp" DESC NULLS LAST, c."id" DESC
 	`, userID)
 	if err != nil {
@@ -88,38 +101,71 @@ func handleGetChats(w http.ResponseWriter, r *http.Request) {
 	var chats []chatPreviewResponse
 	for rows.Next() {
 		var c chatPreviewResponse
-		var otherUserID int64
-		var lastTime *time.Time
-		var avatarURL *string
 		var lastMsg *string
 
 		if err := rows.Scan(
 			&c.ID,
-			&otherUserID,
-			&c.UserName,
-			&avatarURL,
+			&c.Kind,
+			&c.Title,
+			&c.MyRole,
 			&lastMsg,
-			&lastTime,
+			&c.LastTime,
 			&c.UnreadCount,
+			&c.Closed,
 		); err != nil {
 			writeError(w, http.StatusInternalServerError, "Failed to scan chat")
 			return
 		}
 
-		c.OtherUser = &otherUserID
-		c.AvatarURL = avatarURL
 		if lastMsg != nil {
 			c.LastMsg = *lastMsg
-		} else {
-			c.LastMsg = ""
 		}
-		c.LastTime = lastTime
-
 		chats = append(chats, c)
 	}
+	if rows.Err() != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to load chats")
+		return
+	}
+
+	ids := make([]int64, len(chats))
+	for i, c := range chats {
+		ids[i] = c.ID
+	}
+	members, err := loadChatMembers(ctx, db, ids)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to load chat members")
+		return
+	}
+
+	out := make([]chatPreviewResponse, 0, len(chats))
+	for _, c := range chats {
+		c.Members = members[c.ID]
+		if c.Members == nil {
+			c.Members = []chatMemberResponse{}
+		}
+		if c.Kind == chatKindGroup {
+			if c.Title != nil {
+				c.UserName = *c.Title
+			}
+			out = append(out, c)
+			continue
+		}
+		// 1-1: шапка — второй участник; без него (удалил аккаунт) чат не показываем
+		for _, m := range c.Members {
+			if m.UserID != userID {
+				otherID := m.UserID
+				c.OtherUser = &otherID
+				c.UserName = m.Name
+				c.AvatarURL = m.AvatarURL
+			}
+		}
+		if c.OtherUser != nil {
+			out = append(out, c)
+		}
+	}
 
 	writeJSON(w, http.StatusOK, map[string]interface{}{
-		"chats": chats,
+		"chats": out,
 	})
 }
 
@@ -142,15 +188,9 @@ func handleGetChatMessages(w http.ResponseWriter, r *http.Request) {
 	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
 	defer cancel()
 
-	// проверяем, что пользователь участник чата
-	var exists bool
-	err = db.QueryRow(ctx, `
-		SELECT EXISTS(
-			SELECT 1 FROM "ChatUser"
-			WHERE "chatId" = $1 AND "userId" = $2
-		)
-	`, chatID, userID).Scan(&exists)
-	if err != nil || !exists {
+	// проверяем, что пользователь участник чата и не скрыл его
+	closed, err := chatAccess(ctx, db, chatID, userID)
+	if err != nil {
 		writeError(w, http.StatusNotFound, "Chat not found")
 		return
 	}
@@ -226,13 +266,198 @@ func handleGetChatMessages(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, http.StatusOK, map[string]any{
 		"messages": msgs,
 		"hasMore":  hasMore,
+		"closed":   closed,
 	})
 }
 
 // ===== POST /chats/{id}/messages =====
 
 type sendMessageRequest struct {
-	Content string `json:"content"`
+	Content  string `json:"content"`
+	ClientID string `json:"clientId"` // необязательный id от клиента: повтор с тем же id не создаёт дубль
+}
+
+const clientMessageIDMax = 64
+
+var (
+	errEmptyMessage    = errors.New("message content is required")
+	errInvalidClientID = errors.New("invalid client id")
+	errChatClosed      = errors.New("chat is closed")
+	errClientIDReused  = errors.New("client id already used in another chat")
+)
+
+// sentMessage — результат sendChatMessage
+type sentMessage struct {
+	message    chatMessageResponse
+	recipients []int64 // кому разослать new_message
+	duplicate  bool    // повтор по clientId: сообщение уже сохранено и разослано раньше
+}
+
+// sendChatMessage — общий путь отправки для HTTP и WebSocket: участие в чате,
+// анматч, блоки, chatPolicy, запись и read state отправителя. Рассылку делает
+// вызывающий через fanOutChatMessage.
+func sendChatMessage(ctx context.Context, userID, chatID int64, content, clientID string) (sentMessage, error) {
+	var out sentMessage
+	content = strings.TrimSpace(content)
+	if content == "" {
+		return out, errEmptyMessage
+	}
+	clientID = strings.TrimSpace(clientID)
+	if len(clientID) > clientMessageIDMax {
+		return out, errInvalidClientID
+	}
+
+	// остальные участники — им уйдёт ws-событие; в 1-1 это второй участник пары
+	kind, recipients, err := chatRecipients(ctx, db, chatID, userID)
+	if err != nil {
+		return out, err
+	}
+	out.recipients = recipients
+	var otherUserID int64
+	if kind == chatKindDirect && len(recipients) == 1 {
+		otherUserID = recipients[0]
+	}
+
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return out, err
+	}
+	defer tx.Rollback(ctx)
+
+	// лок пары: проверки ниже и вставка не разъедутся с анматчем или вторым
+	// сообщением по запросу
+	if otherUserID > 0 {
+		if err := lockConnectionPair(ctx, tx, userID, otherUserID); err != nil {
+			return out, err
+		}
+	}
+
+	// проверяем, что пользователь в чате и чат не закрыт анматчем
+	closed, err := chatAccess(ctx, tx, chatID, userID)
+	if err != nil {
+		return out, err
+	}
+
+	// повтор уже сохранённого сообщения — отдаём его, не проверяя права заново
+	if clientID != "" {
+		existing, err := messageByClientID(ctx, tx, userID, clientID)
+		if err == nil {
+			if existing.ChatID != chatID {
+				return out, errClientIDReused
+			}
+			out.message, out.duplicate = existing, true
+			return out, nil
+		}
+		if !errors.Is(err, pgx.ErrNoRows) {
+			return out, err
+		}
+	}
+
+	if closed {
+		return out, errChatClosed
+	}
+	if otherUserID > 0 {
+		blocked, err := isBlockedBetween(ctx, tx, userID, otherUserID)
+		if err != nil {
+			return out, err
+		}
+		if blocked {
+			return out, errUserBlocked
+		}
+		if err := checkChatPolicy(ctx, tx, chatActionSend, userID, otherUserID, chatID); err != nil {
+			return out, err
+		}
+	}
+
+	m := chatMessageResponse{ChatID: chatID, SenderID: userID, Content: content}
+	if clientID != "" {
+		m.ClientID = &clientID
+	}
+	err = tx.QueryRow(ctx, `
+		INSERT INTO "Message" ("chatId","senderId","content","clientId")
+		VALUES ($1,$2,$3,$4)
+		ON CONFLICT ("senderId","clientId") WHERE "clientId" IS NOT NULL DO NOTHING
+		RETURNING "id","timestamp"
+	`, chatID, userID, content, m.ClientID).Scan(&m.ID, &m.Timestamp)
+	if errors.Is(err, pgx.ErrNoRows) {
+		// параллельный повтор с тем же clientId успел раньше
+		existing, err := messageByClientID(ctx, db, userID, clientID)
+		if err != nil {
+			return out, err
+		}
+		if existing.ChatID != chatID {
+			return out, errClientIDReused
+		}
+		out.message, out.duplicate = existing, true
+		return out, nil
+	}
+	if err != nil {
+		return out, err
+	}
+
+	// обновляем read state отправителя
+	_, err = tx.Exec(ctx, `
+		INSERT INTO "ChatRead" ("chatId","userId","lastReadAt")
+		VALUES ($1,$2,$3)
+		ON CONFLICT ("chatId","userId") DO UPDATE
+		SET "lastReadAt" = EXCLUDED."lastReadAt"
+	`, chatID, userID, m.Timestamp)
+	if err != nil {
+		return out, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return out, err
+	}
+	out.message = m
+	return out, nil
+}
+
+func messageByClientID(ctx context.Context, q dbtx, userID int64, clientID string) (chatMessageResponse, error) {
+	var m chatMessageResponse
+	err := q.QueryRow(ctx, `
+		SELECT "id", "chatId", "senderId", "content", "timestamp", "clientId"
+		FROM "Message"
+		WHERE "senderId" = $1 AND "clientId" = $2
+	`, userID, clientID).Scan(&m.ID, &m.ChatID, &m.SenderID, &m.Content, &m.Timestamp, &m.ClientID)
+	return m, err
+}
+
+// fanOutChatMessage — new_message остальным участникам (повтор не рассылается)
+func fanOutChatMessage(ctx context.Context, userID int64, sent sentMessage) {
+	if sent.duplicate {
+		return
+	}
+	msg := sent.message
+	wsFanOut(ctx, userID, sent.recipients, wsOutgoing{
+		Type:       "new_message",
+		ChatID:     msg.ChatID,
+		FromUserID: userID,
+		Message:    &msg,
+	})
+}
+
+// chatSendErrorStatus — HTTP-код и текст ошибки отправки (для ws — то же в кадре ошибки)
+func chatSendErrorStatus(err error) (int, string) {
+	switch {
+	case errors.Is(err, errEmptyMessage):
+		return http.StatusBadRequest, "Message content is required"
+	case errors.Is(err, errInvalidClientID):
+		return http.StatusBadRequest, "clientId must be at most 64 characters"
+	case errors.Is(err, errChatNotFound):
+		return http.StatusNotFound, "Chat not found"
+	case errors.Is(err, errChatClosed):
+		return http.StatusForbidden, "This chat is closed"
+	case errors.Is(err, errUserBlocked):
+		return http.StatusForbidden, "You cannot message this user"
+	case errors.Is(err, errChatNotAllowed):
+		return http.StatusForbidden, "You can only message your matches"
+	case errors.Is(err, errMessageRequestUsed):
+		return http.StatusForbidden, "Message request already sent, wait for a match"
+	case errors.Is(err, errClientIDReused):
+		return http.StatusConflict, "clientId already used in another chat"
+	default:
+		return http.StatusInternalServerError, "Failed to send message"
+	}
 }
 
 func handleSendChatMessage(w http.ResponseWriter, r *http.Request) {
@@ -254,74 +479,22 @@ func handleSendChatMessage(w http.ResponseWriter, r *http.Request) {
 		writeError(w, http.StatusBadRequest, "Invalid JSON")
 		return
 	}
-	body.Content = strings.TrimSpace(body.Content)
-	if body.Content == "" {
-		writeError(w, http.StatusBadRequest, "Message content is required")
-		return
-	}
 
 	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
 	defer cancel()
 
-	// проверяем, что пользователь в чате
-	var exists bool
-	err = db.QueryRow(ctx, `
-		SELECT EXISTS(
-			SELECT 1 FROM "ChatUser"
-			WHERE "chatId" = $1 AND "userId" = $2
-		)
-	`, chatID, userID).Scan(&exists)
-	if err != nil || !exists {
-		writeError(w, http.StatusNotFound, "Chat not found")
-		return
-	}
-
-	var msgID int64
-	var ts time.Time
-	err = db.QueryRow(ctx, `
-		INSERT INTO "Message" ("chatId","senderId","content")
-		VALUES ($1,$2,$3)
-		RETURNING "id","timestamp"
-	`, chatID, userID, body.Content).Scan(&msgID, &ts)
+	sent, err := sendChatMessage(ctx, userID, chatID, body.Content, body.ClientID)
 	if err != nil {
-		writeError(w, http.StatusInternalServerError, "Failed to send message")
+		status, msg := chatSendErrorStatus(err)
+		if status == http.StatusInternalServerError {
+			log.Printf("send message to chat %d: %v", chatID, err)
+		}
+		writeError(w, status, msg)
 		return
 	}
+	fanOutChatMessage(ctx, userID, sent)
 
-	// обновляем read state отправителя
-	_, _ = db.Exec(ctx, `
-		INSERT INTO "ChatRead" ("chatId","userId","lastReadAt")
-		VALUES ($1,$2,$3)
-		ON CONFLICT ("chatId","userId") DO UPDATE
-		SET "lastReadAt" = EXCLUDED."lastReadAt"
-	`, chatID, userID, ts)
-
-	resp := chatMessageResponse{
-		ID:        msgID,
-		ChatID:    chatID,
-		SenderID:  userID,
-		Content:   body.Content,
-		Timestamp: ts,
-	}
-
-	// ищем второго участника чата и шлём ему ws-событие
-	var otherUserID int64
-	err = db.QueryRow(ctx, `
-		SELECT "userId"
-		FROM "ChatUser"
-		WHERE "chatId" = $1 AND "userId" <> $2
-		LIMIT 1
-	`, chatID, userID).Scan(&otherUserID)
-	if err == nil && otherUserID > 0 {
-		wsSendToUser(otherUserID, wsOutgoing{
-			Type:       "new_message",
-			ChatID:     chatID,
-			FromUserID: userID,
-			Message:    &resp,
-		})
-	}
-
-	writeJSON(w, http.StatusOK, resp)
+	writeJSON(w, http.StatusOK, sent.message)
 }
 
 // ===== POST /chats/with/{userId} =====
@@ -354,6 +527,23 @@ func handleEnsureChatWith(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// с заблокированными (в любую сторону) чат не создаём — маскируем как 404
+	blocked, err := isBlockedBetween(ctx, db, userID, targetID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to check blocks")
+		return
+	}
+	if blocked {
+		writeError(w, http.StatusNotFound, "User not found")
+		return
+	}
+
+	// матч, запрос по суперлайку или поддержка
+	if err := checkChatPolicy(ctx, db, chatActionOpen, userID, targetID, 0); err != nil {
+		writeChatPolicyError(w, err)
+		return
+	}
+
 	// ищем существующий чат 1–1
 	var chatID int64
 	err = db.QueryRow(ctx, `
@@ -361,6 +551,7 @@ func handleEnsureChatWith(w http.ResponseWriter, r *http.Request) {
 		FROM "Chat" c
 		JOIN "ChatUser" cu1 ON cu1."chatId" = c."id" AND cu1."userId" = $1
 		JOIN "ChatUser" cu2 ON cu2."chatId" = c."id" AND cu2."userId" = $2
+		WHERE c."kind" = 'DIRECT'
 		LIMIT 1
 	`, userID, targetID).Scan(&chatID)
 	if err == nil && chatID > 0 {
@@ -393,3 +584,64 @@ func handleEnsureChatWith(w http.ResponseWriter, r *http.Request) {
 		"chatId": chatID,
 	})
 }
+
+// ===== анматч: закрытие чата =====
+
+// closeChatsBetween делает чаты пары только для чтения и скрывает их у userID
+// (тот, кто разорвал матч); возвращает id закрытых чатов
+func closeChatsBetween(ctx context.Context, q dbtx, userID, otherID int64) ([]int64, error) {
+	rows, err := q.Query(ctx, `
+		UPDATE "Chat" c SET "closedAt" = NOW()
+		WHERE c."closedAt" IS NULL
+		  AND c."kind" = 'DIRECT'
+		  AND EXISTS (SELECT 1 FROM "ChatUser" cu WHERE cu."chatId" = c."id" AND cu."userId" = $1)
+		  AND EXISTS (SELECT 1 FROM "ChatUser" cu WHERE cu."chatId" = c."id" AND cu."userId" = $2)
+		RETURNING c."id"
+	`, userID, otherID)
+	if err != nil {
+		return nil, err
+	}
+	ids, err := pgx.CollectRows(rows, pgx.RowTo[int64])
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = q.Exec(ctx, `
+		UPDATE "ChatUser" SET "hiddenAt" = NOW()
+		WHERE "chatId" = ANY($1) AND "userId" = $2
+	`, ids, userID)
+	return ids, err
+}
+
+// reopenChatsBetween — обратное для повторного матча: чат снова открыт и виден обоим
+func reopenChatsBetween(ctx context.Context, q dbtx, userID, otherID int64) error {
+	_, err := q.Exec(ctx, `
+		WITH reopened AS (
+			UPDATE "Chat" c SET "closedAt" = NULL
+			WHERE c."closedAt" IS NOT NULL
+			  AND c."kind" = 'DIRECT'
+			  AND EXISTS (SELECT 1 FROM "ChatUser" cu WHERE cu."chatId" = c."id" AND cu."userId" = $1)
+			  AND EXISTS (SELECT 1 FROM "ChatUser" cu WHERE cu."chatId" = c."id" AND cu."userId" = $2)
+			RETURNING c."id"
+		)
+		UPDATE "ChatUser" cu SET "hiddenAt" = NULL
+		FROM reopened
+		WHERE cu."chatId" = reopened."id"
+	`, userID, otherID)
+	return err
+}
+
+// chatAccess — виден ли чат юзеру и закрыт ли он; errChatNotFound, если юзер
+// не участник или скрыл чат
+func chatAccess(ctx context.Context, q dbtx, chatID, userID int64) (closed bool, err error) {
+	err = q.QueryRow(ctx, `
+		SELECT c."closedAt" IS NOT NULL
+		FROM "ChatUser" cu
+		JOIN "Chat" c ON c."id" = cu."chatId"
+		WHERE cu."chatId" = $1 AND cu."userId" = $2 AND cu."hiddenAt" IS NULL
+	`, chatID, userID).Scan(&closed)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, errChatNotFound
+	}
+	return closed, err
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// ===== кто кому может писать =====
+//
+// Решение принимает chatPolicy.check по заранее собранным фактам о паре
+// (chatFacts) — без похода в базу, поэтому правила легко проверять отдельно.
+// В режиме "matched" писать можно:
+//   - в матче;
+//   - по суперлайку, пока нет матча: открыть чат и отправить до
+//     CHAT_MESSAGE_REQUEST_LIMIT сообщений ("запрос на переписку"); получатель
+//     отвечает, приняв коннекшен; если он дизлайкнул — запрос закрыт;
+//   - поддержке (роли из CHAT_SUPPORT_ROLES) — кому угодно, и ей в ответ.
+// Добавить в группу можно только матч (или это делает поддержка): в группе
+// лимит запроса на переписку уже не действует.
+// Блоки и закрытые анматчем чаты проверяются отдельно и сильнее политики.
+
+const (
+	chatPolicyMatched = "matched"
+	chatPolicyOpen    = "open"
+)
+
+type chatAction int
+
+const (
+	chatActionOpen      chatAction = iota // POST /chats/with/{userId}
+	chatActionSend                        // новое сообщение
+	chatActionAddMember                   // добавить в групповой чат
+)
+
+var (
+	errChatNotAllowed     = errors.New("you can only message your matches")
+	errMessageRequestUsed = errors.New("message request already sent, wait for a match")
+)
+
+type chatPolicy struct {
+	mode            string
+	messageRequests int // 0 — суперлайк не даёт писать
+	supportRoles    map[string]bool
+}
+
+// chatFacts — всё, что нужно политике о паре "отправитель -> получатель"
+type chatFacts struct {
+	matched       bool
+	myAction      string // действие отправителя в паре: LIKED/SUPERLIKED/DISLIKED или ""
+	otherAction   string // действие получателя в ответ
+	senderRole    string
+	recipientRole string
+	sentInChat    int // сколько сообщений отправитель уже написал в этот чат
+}
+
+var chatRules chatPolicy
+
+func newChatPolicy(cfg Config) (chatPolicy, error) {
+	if cfg.ChatPolicy != chatPolicyMatched && cfg.ChatPolicy != chatPolicyOpen {
+		return chatPolicy{}, fmt.Errorf("unknown chat policy %q", cfg.ChatPolicy)
+	}
+	p := chatPolicy{
+		mode:            cfg.ChatPolicy,
+		messageRequests: max(cfg.ChatMessageRequestLimit, 0),
+		supportRoles:    map[string]bool{},
+	}
+	for _, role := range cfg.ChatSupportRoles {
+		p.supportRoles[role] = true
+	}
+	return p, nil
+}
+
+func initChatPolicy(cfg Config) error {
+	p, err := newChatPolicy(cfg)
+	if err != nil {
+		return err
+	}
+	chatRules = p
+	return nil
+}
+
+// check — можно ли отправителю выполнить action; nil — можно
+func (p chatPolicy) check(action chatAction, f chatFacts) error {
+	if p.mode == chatPolicyOpen {
+		return nil
+	}
+	if p.supportRoles[f.senderRole] {
+		return nil
+	}
+	if action == chatActionAddMember {
+		if f.matched {
+			return nil
+		}
+		return errChatNotAllowed
+	}
+	// поддержке отвечают в уже открытом ею чате, но сами не начинают
+	if action == chatActionSend && p.supportRoles[f.recipientRole] {
+		return nil
+	}
+	if f.matched {
+		return nil
+	}
+	// получатель уже отказал — запрос на переписку больше не отправить
+	if f.otherAction == connDisliked {
+		return errChatNotAllowed
+	}
+	if p.messageRequests > 0 && f.myAction == connSuperLiked {
+		if action == chatActionOpen || f.sentInChat < p.messageRequests {
+			return nil
+		}
+		return errMessageRequestUsed
+	}
+	return errChatNotAllowed
+}
+
+// loadChatFacts собирает факты о паре; chatID == 0 — чата ещё нет
+func loadChatFacts(ctx context.Context, q dbtx, senderID, recipientID, chatID int64) (chatFacts, error) {
+	var f chatFacts
+	err := q.QueryRow(ctx, `
+		SELECT
+			COALESCE(cs."matchedAt" IS NOT NULL, FALSE),
+			COALESCE(cs."action", ''),
+			COALESCE(cs."otherAction", ''),
+			COALESCE((SELECT "role" FROM "User" WHERE "id" = $1), ''),
+			COALESCE((SELECT "role" FROM "User" WHERE "id" = $2), ''),
+			(SELECT COUNT(*) FROM "Message" WHERE "chatId" = $3 AND "senderId" = $1)
+		FROM (SELECT 1) one
+		LEFT JOIN "ConnectionSide" cs ON cs."userId" = $1 AND cs."otherUserId" = $2
+	`, senderID, recipientID, chatID).Scan(&f.matched, &f.myAction, &f.otherAction, &f.senderRole, &f.recipientRole, &f.sentInChat)
+	return f, err
+}
+
+// checkChatPolicy — loadChatFacts + check
+func checkChatPolicy(ctx context.Context, q dbtx, action chatAction, senderID, recipientID, chatID int64) error {
+	f, err := loadChatFacts(ctx, q, senderID, recipientID, chatID)
+	if err != nil {
+		return err
+	}
+	return chatRules.check(action, f)
+}
+
+// writeChatPolicyError — 403 для отказов политики, 500 для остального
+func writeChatPolicyError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, errChatNotAllowed):
+		writeError(w, http.StatusForbidden, "You can only message your matches")
+	case errors.Is(err, errMessageRequestUsed):
+		writeError(w, http.StatusForbidden, "Message request already sent, wait for a match")
+	default:
+		writeError(w, http.StatusInternalServerError, "Failed to check chat permissions")
+	}
+}
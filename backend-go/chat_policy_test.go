@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestChatPolicyCheck(t *testing.T) {
+	mustPolicy := func(mode string, requests int) chatPolicy {
+		p, err := newChatPolicy(Config{
+			ChatPolicy:              mode,
+			ChatMessageRequestLimit: requests,
+			ChatSupportRoles:        []string{"SUPPORT"},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+	matched := mustPolicy(chatPolicyMatched, 2)
+	noRequests := mustPolicy(chatPolicyMatched, 0)
+	open := mustPolicy(chatPolicyOpen, 2)
+
+	tests := []struct {
+		name   string
+		policy chatPolicy
+		action chatAction
+		facts  chatFacts
+		want   error
+	}{
+		{"open mode: strangers", open, chatActionOpen, chatFacts{}, nil},
+		{"open mode: send", open, chatActionSend, chatFacts{sentInChat: 10}, nil},
+
+		{"matched: open", matched, chatActionOpen, chatFacts{matched: true}, nil},
+		{"matched: send", matched, chatActionSend, chatFacts{matched: true, myAction: connLiked, sentInChat: 10}, nil},
+
+		{"superlike: open", matched, chatActionOpen, chatFacts{myAction: connSuperLiked, sentInChat: 5}, nil},
+		{"superlike: first message", matched, chatActionSend, chatFacts{myAction: connSuperLiked}, nil},
+		{"superlike: last allowed message", matched, chatActionSend, chatFacts{myAction: connSuperLiked, sentInChat: 1}, nil},
+		{"superlike: over the limit", matched, chatActionSend, chatFacts{myAction: connSuperLiked, sentInChat: 2}, errMessageRequestUsed},
+
+		{"superlike: declined, open", matched, chatActionOpen, chatFacts{myAction: connSuperLiked, otherAction: connDisliked}, errChatNotAllowed},
+		{"superlike: declined, send", matched, chatActionSend, chatFacts{myAction: connSuperLiked, otherAction: connDisliked}, errChatNotAllowed},
+		{"support sender: declined", matched, chatActionSend, chatFacts{senderRole: "SUPPORT", otherAction: connDisliked}, nil},
+		{"superlike: add to group", matched, chatActionAddMember, chatFacts{myAction: connSuperLiked}, errChatNotAllowed},
+		{"matched: add to group", matched, chatActionAddMember, chatFacts{matched: true}, nil},
+		{"support: add to group", matched, chatActionAddMember, chatFacts{senderRole: "SUPPORT"}, nil},
+		{"open mode: add to group", open, chatActionAddMember, chatFacts{}, nil},
+		{"add support to group", matched, chatActionAddMember, chatFacts{recipientRole: "SUPPORT"}, errChatNotAllowed},
+
+		{"no requests: superlike open", noRequests, chatActionOpen, chatFacts{myAction: connSuperLiked}, errChatNotAllowed},
+		{"no requests: superlike send", noRequests, chatActionSend, chatFacts{myAction: connSuperLiked}, errChatNotAllowed},
+
+		{"support sender: open", matched, chatActionOpen, chatFacts{senderRole: "SUPPORT"}, nil},
+		{"support sender: send", noRequests, chatActionSend, chatFacts{senderRole: "SUPPORT", sentInChat: 10}, nil},
+
+		{"reply to support", matched, chatActionSend, chatFacts{recipientRole: "SUPPORT", sentInChat: 10}, nil},
+		{"open chat with support", matched, chatActionOpen, chatFacts{recipientRole: "SUPPORT"}, errChatNotAllowed},
+
+		{"default deny: open", matched, chatActionOpen, chatFacts{}, errChatNotAllowed},
+		{"default deny: like only", matched, chatActionSend, chatFacts{myAction: connLiked}, errChatNotAllowed},
+		{"default deny: unknown role", matched, chatActionSend, chatFacts{senderRole: "USER", recipientRole: "USER"}, errChatNotAllowed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.policy.check(tt.action, tt.facts)
+			if !errors.Is(err, tt.want) {
+				t.Errorf("got %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewChatPolicyRejectsUnknownMode(t *testing.T) {
+	if _, err := newChatPolicy(Config{ChatPolicy: "friends"}); err == nil {
+		t.Fatal("unknown chat policy accepted")
+	}
+}
+
+func withChatPolicy(t *testing.T, cfg Config) {
+	t.Helper()
+	p, err := newChatPolicy(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	prev := chatRules
+	chatRules = p
+	t.Cleanup(func() { chatRules = prev })
+}
+
+func createTestGroup(t *testing.T, ctx context.Context, ownerID int64) int64 {
+	t.Helper()
+	var chatID int64
+	err := db.QueryRow(ctx, `
+		WITH c AS (
+			INSERT INTO "Chat" ("kind","title","createdById") VALUES ('GROUP', 'test', $1) RETURNING "id"
+		)
+		INSERT INTO "ChatUser" ("chatId","userId","role") SELECT "id", $1, 'OWNER' FROM c
+		RETURNING "chatId"
+	`, ownerID).Scan(&chatID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return chatID
+}
+
+// суперлайк не даёт обойти лимит запроса через группу: добавить нельзя,
+// и сообщения группы до получателя не доходят
+func TestSuperLikerCannotAddToGroup(t *testing.T) {
+	ctx := setupTestDB(t)
+	withChatPolicy(t, Config{ChatPolicy: chatPolicyMatched, ChatMessageRequestLimit: 1})
+	a, b := createTestUser(t, ctx), createTestUser(t, ctx)
+
+	if _, err := swipeInTx(ctx, a, b, connSuperLiked); err != nil {
+		t.Fatal(err)
+	}
+	chatID := createTestGroup(t, ctx, a)
+
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = addGroupMembers(ctx, tx, chatID, a, []int64{b})
+	tx.Rollback(ctx)
+	if !errors.Is(err, errChatNotAllowed) {
+		t.Fatalf("super-liker adding the target: got %v, want errChatNotAllowed", err)
+	}
+
+	_, recipients, err := chatRecipients(ctx, db, chatID, a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range recipients {
+		if id == b {
+			t.Fatal("a group message from the super-liker would reach the target")
+		}
+	}
+
+	// после матча — можно
+	if _, err := swipeInTx(ctx, b, a, connLiked); err != nil {
+		t.Fatal(err)
+	}
+	tx, err = db.Begin(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback(ctx)
+	if err := addGroupMembers(ctx, tx, chatID, a, []int64{b}); err != nil {
+		t.Fatalf("adding a match: %v", err)
+	}
+}
@@ -0,0 +1,197 @@
+// cmd/affinity/main.go
+//
+// Offline collaborative filtering ("people like you also liked").
+//
+// Builds an item-item model from the like graph in "Connection": two users are
+// similar as candidates when the same people liked both of them (cosine over
+// their sets of likers). For every user the affinity of a candidate is the sum
+// of its similarity to everyone that user already liked, normalised to 0..1.
+// The top scores per user are written to "CandidateAffinity", which
+// /recommendations blends in once a user has enough likes.
+//
+// Runs on one machine, in memory, against the local database:
+//
+//	go run ./cmd/affinity [-top 200] [-min-support 2] [-max-likes 300]
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"math"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/joho/godotenv"
+)
+
+type pair struct{ a, b int64 }
+
+type scored struct {
+	id    int64
+	score float64
+}
+
+func main() {
+	_ = godotenv.Load()
+
+	top := flag.Int("top", 200, "how many candidates to keep per user")
+	minSupport := flag.Int("min-support", 2, "minimum number of common likers for two candidates to count as similar")
+	maxLikes := flag.Int("max-likes", 300, "only use each user's most recent N likes")
+	flag.Parse()
+
+	dbURL := os.Getenv("DATABASE_URL")
+	if dbURL == "" {
+		log.Fatal("DATABASE_URL is not set")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Minute)
+	defer cancel()
+
+	pool, err := pgxpool.New(ctx, dbURL)
+	if err != nil {
+		log.Fatalf("failed to create pgx pool: %v", err)
+	}
+	defer pool.Close()
+
+	start := time.Now()
+
+	// кто кого лайкнул; в матче действия обеих сторон — лайки
+	rows, err := pool.Query(ctx, `
+		SELECT "userId", "otherUserId", "actedAt"
+		FROM "ConnectionSide"
+		WHERE "action" IN ('LIKED','SUPERLIKED')
+		ORDER BY 3 DESC
+	`)
+	if err != nil {
+		log.Fatalf("failed to load likes: %v", err)
+	}
+
+	likes := map[int64][]int64{} // user -> кого лайкнул (свежие первыми)
+	likers := map[int64]int{}    // кандидат -> сколько раз его лайкнули
+	for rows.Next() {
+		var from, to int64
+		var at time.Time
+		if err := rows.Scan(&from, &to, &at); err != nil {
+			log.Fatalf("failed to scan like: %v", err)
+		}
+		if len(likes[from]) >= *maxLikes {
+			continue
+		}
+		likes[from] = append(likes[from], to)
+		likers[to]++
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		log.Fatalf("failed to read likes: %v", err)
+	}
+
+	// уже свайпнутых (в любую сторону) не рекомендуем
+	swiped := map[pair]bool{}
+	rows, err = pool.Query(ctx, `SELECT "userId", "otherUserId" FROM "ConnectionSide" WHERE "action" IS NOT NULL`)
+	if err != nil {
+		log.Fatalf("failed to load connections: %v", err)
+	}
+	for rows.Next() {
+		var from, to int64
+		if err := rows.Scan(&from, &to); err != nil {
+			log.Fatalf("failed to scan connection: %v", err)
+		}
+		swiped[pair{from, to}] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		log.Fatalf("failed to read connections: %v", err)
+	}
+
+	// совместная встречаемость: сколько людей лайкнули и a, и b
+	co := map[pair]int{}
+	for _, items := range likes {
+		for i := 0; i < len(items); i++ {
+			for j := i + 1; j < len(items); j++ {
+				a, b := items[i], items[j]
+				if a > b {
+					a, b = b, a
+				}
+				co[pair{a, b}]++
+			}
+		}
+	}
+
+	// косинусная близость между кандидатами
+	neighbours := map[int64][]scored{}
+	for p, n := range co {
+		if n < *minSupport {
+			continue
+		}
+		sim := float64(n) / math.Sqrt(float64(likers[p.a])*float64(likers[p.b]))
+		neighbours[p.a] = append(neighbours[p.a], scored{p.b, sim})
+		neighbours[p.b] = append(neighbours[p.b], scored{p.a, sim})
+	}
+
+	now := time.Now()
+	var out [][]any
+	for user, items := range likes {
+		acc := map[int64]float64{}
+		for _, item := range items {
+			for _, nb := range neighbours[item] {
+				if nb.id == user || swiped[pair{user, nb.id}] {
+					continue
+				}
+				acc[nb.id] += nb.score
+			}
+		}
+		if len(acc) == 0 {
+			continue
+		}
+
+		list := make([]scored, 0, len(acc))
+		maxScore := 0.0
+		for id, s := range acc {
+			list = append(list, scored{id, s})
+			maxScore = math.Max(maxScore, s)
+		}
+		sort.Slice(list, func(i, j int) bool {
+			if list[i].score == list[j].score {
+				return list[i].id < list[j].id
+			}
+			return list[i].score > list[j].score
+		})
+		if len(list) > *top {
+			list = list[:*top]
+		}
+		for _, c := range list {
+			out = append(out, []any{user, c.id, c.score / maxScore, now})
+		}
+	}
+
+	// целиком заменяем прошлый результат
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		log.Fatalf("failed to start transaction: %v", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, `DELETE FROM "CandidateAffinity"`); err != nil {
+		log.Fatalf("failed to clear affinities: %v", err)
+	}
+	if len(out) > 0 {
+		_, err = tx.CopyFrom(ctx,
+			pgx.Identifier{"CandidateAffinity"},
+			[]string{"userId", "candidateId", "score", "computedAt"},
+			pgx.CopyFromRows(out),
+		)
+		if err != nil {
+			log.Fatalf("failed to write affinities: %v", err)
+		}
+	}
+	if err := tx.Commit(ctx); err != nil {
+		log.Fatalf("failed to commit affinities: %v", err)
+	}
+
+	log.Printf("Affinity: %d users with likes, %d co-liked candidate pairs, %d scores written in %s",
+		len(likes), len(co), len(out), time.Since(start).Round(time.Millisecond))
+}
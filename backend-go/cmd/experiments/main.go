@@ -0,0 +1,110 @@
+// cmd/experiments/main.go
+//
+// Report for ranking A/B experiments: per variant, how many impressions were
+// served and which share of them turned into likes and matches. Reads the
+// "RecommendationEvent" log written by the API.
+//
+//	go run ./cmd/experiments [-experiment name] [-since 168h]
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/joho/godotenv"
+)
+
+type variantStats struct {
+	experiment  string
+	variant     string
+	users       int64
+	impressions int64
+	likes       int64
+	matches     int64
+}
+
+func ratio(a, b int64) string {
+	if b == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%.2f%%", 100*float64(a)/float64(b))
+}
+
+func main() {
+	_ = godotenv.Load()
+
+	experiment := flag.String("experiment", "", "only report this experiment")
+	since := flag.Duration("since", 0, "only count events newer than this (e.g. 168h); 0 = all")
+	flag.Parse()
+
+	dbURL := os.Getenv("DATABASE_URL")
+	if dbURL == "" {
+		log.Fatal("DATABASE_URL is not set")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+
+	pool, err := pgxpool.New(ctx, dbURL)
+	if err != nil {
+		log.Fatalf("failed to create pgx pool: %v", err)
+	}
+	defer pool.Close()
+
+	var sinceTime time.Time
+	if *since > 0 {
+		sinceTime = time.Now().Add(-*since)
+	}
+
+	// пары (юзер, кандидат) считаем один раз: повторный показ той же карточки
+	// не должен размывать like rate
+	rows, err := pool.Query(ctx, `
+		SELECT "experiment", "variant",
+		       COUNT(DISTINCT "userId"),
+		       COUNT(DISTINCT ("userId","candidateId")) FILTER (WHERE "type" = 'IMPRESSION'),
+		       COUNT(DISTINCT ("userId","candidateId")) FILTER (WHERE "type" IN ('LIKE','SUPERLIKE')),
+		       COUNT(DISTINCT ("userId","candidateId")) FILTER (WHERE "type" = 'MATCH')
+		FROM "RecommendationEvent"
+		WHERE "experiment" IS NOT NULL
+		  AND ($1 = '' OR "experiment" = $1)
+		  AND "createdAt" >= $2
+		GROUP BY "experiment", "variant"
+		ORDER BY "experiment", "variant"
+	`, *experiment, sinceTime)
+	if err != nil {
+		log.Fatalf("failed to load events: %v", err)
+	}
+	defer rows.Close()
+
+	var stats []variantStats
+	for rows.Next() {
+		var s variantStats
+		if err := rows.Scan(&s.experiment, &s.variant, &s.users, &s.impressions, &s.likes, &s.matches); err != nil {
+			log.Fatalf("failed to scan row: %v", err)
+		}
+		stats = append(stats, s)
+	}
+	if err := rows.Err(); err != nil {
+		log.Fatalf("failed to read events: %v", err)
+	}
+
+	if len(stats) == 0 {
+		fmt.Println("No experiment events found.")
+		return
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "EXPERIMENT\tVARIANT\tUSERS\tIMPRESSIONS\tLIKES\tMATCHES\tLIKE RATE\tMATCH RATE\tMATCHES/LIKE")
+	for _, s := range stats {
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%d\t%d\t%d\t%s\t%s\t%s\n",
+			s.experiment, s.variant, s.users, s.impressions, s.likes, s.matches,
+			ratio(s.likes, s.impressions), ratio(s.matches, s.impressions), ratio(s.matches, s.likes))
+	}
+	_ = tw.Flush()
+}
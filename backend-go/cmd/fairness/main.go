@@ -0,0 +1,213 @@
+// cmd/fairness/main.go
+//
+// Report on how recommendation impressions are spread across profiles: Gini
+// coefficient, share taken by the most shown profiles, and visibility of new
+// accounts compared to established ones. Reads the "RecommendationEvent" log
+// written by the API.
+//
+//	go run ./cmd/fairness [-since 168h] [-new-days 7]
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/joho/godotenv"
+)
+
+type exposure struct {
+	userID      int64
+	isNew       bool
+	rating      float64
+	impressions int64
+}
+
+// gini по отсортированным по возрастанию значениям: 0 — всем поровну, 1 — всё одному
+func gini(sorted []int64) float64 {
+	var sum, weighted float64
+	for i, v := range sorted {
+		sum += float64(v)
+		weighted += float64(i+1) * float64(v)
+	}
+	n := float64(len(sorted))
+	if sum == 0 || n == 0 {
+		return 0
+	}
+	return (2*weighted)/(n*sum) - (n+1)/n
+}
+
+// доля показов у top доли самых показываемых анкет
+func topShare(sorted []int64, top float64) float64 {
+	k := int(float64(len(sorted))*top + 0.5)
+	if k < 1 {
+		k = 1
+	}
+	var total, topSum int64
+	for i, v := range sorted {
+		total += v
+		if i >= len(sorted)-k {
+			topSum += v
+		}
+	}
+	if total == 0 {
+		return 0
+	}
+	return float64(topSum) / float64(total)
+}
+
+type cohortStats struct {
+	name   string
+	users  int
+	shown  int
+	total  int64
+	median int64
+	p90    int64
+}
+
+func cohort(name string, list []exposure) cohortStats {
+	s := cohortStats{name: name, users: len(list)}
+	if len(list) == 0 {
+		return s
+	}
+	values := make([]int64, len(list))
+	for i, e := range list {
+		values[i] = e.impressions
+		s.total += e.impressions
+		if e.impressions > 0 {
+			s.shown++
+		}
+	}
+	sort.Slice(values, func(i, j int) bool { return values[i] < values[j] })
+	s.median = values[len(values)/2]
+	s.p90 = values[len(values)*9/10]
+	return s
+}
+
+func pct(a, b float64) string {
+	if b == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%.1f%%", 100*a/b)
+}
+
+func main() {
+	_ = godotenv.Load()
+
+	since := flag.Duration("since", 7*24*time.Hour, "count impressions newer than this")
+	newDays := flag.Int("new-days", 7, "accounts younger than this many days count as new")
+	flag.Parse()
+
+	dbURL := os.Getenv("DATABASE_URL")
+	if dbURL == "" {
+		log.Fatal("DATABASE_URL is not set")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+
+	pool, err := pgxpool.New(ctx, dbURL)
+	if err != nil {
+		log.Fatalf("failed to create pgx pool: %v", err)
+	}
+	defer pool.Close()
+
+	now := time.Now()
+	sinceTime := now.Add(-*since)
+	newSince := now.AddDate(0, 0, -*newDays)
+
+	// все анкеты, которые могут попасть в выдачу, включая ни разу не показанные
+	rows, err := pool.Query(ctx, `
+		SELECT u."id", u."createdAt" >= $2, COALESCE(ur."rating", 1000),
+		       COALESCE(e."impressions", 0)
+		FROM "User" u
+		INNER JOIN "Profile" p ON p."userId" = u."id"
+		INNER JOIN "Preferences" pr ON pr."userId" = u."id"
+		INNER JOIN "Bio" b ON b."userId" = u."id"
+		LEFT JOIN "UserRating" ur ON ur."userId" = u."id"
+		LEFT JOIN (
+			SELECT "candidateId", COUNT(*) AS "impressions"
+			FROM "RecommendationEvent"
+			WHERE "type" = 'IMPRESSION'
+			  AND "createdAt" >= $1
+			GROUP BY "candidateId"
+		) e ON e."candidateId" = u."id"
+	`, sinceTime, newSince)
+	if err != nil {
+		log.Fatalf("failed to load impressions: %v", err)
+	}
+	defer rows.Close()
+
+	var all []exposure
+	for rows.Next() {
+		var e exposure
+		if err := rows.Scan(&e.userID, &e.isNew, &e.rating, &e.impressions); err != nil {
+			log.Fatalf("failed to scan row: %v", err)
+		}
+		all = append(all, e)
+	}
+	if err := rows.Err(); err != nil {
+		log.Fatalf("failed to read impressions: %v", err)
+	}
+	if len(all) == 0 {
+		fmt.Println("No eligible profiles found.")
+		return
+	}
+
+	sort.Slice(all, func(i, j int) bool { return all[i].impressions < all[j].impressions })
+	values := make([]int64, len(all))
+	var total int64
+	for i, e := range all {
+		values[i] = e.impressions
+		total += e.impressions
+	}
+
+	fmt.Printf("Impressions since %s: %d across %d eligible profiles\n\n",
+		sinceTime.Format(time.RFC3339), total, len(all))
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "Gini coefficient\t%.3f\n", gini(values))
+	fmt.Fprintf(tw, "Top 1%% of profiles\t%s of impressions\n", pct(topShare(values, 0.01), 1))
+	fmt.Fprintf(tw, "Top 10%% of profiles\t%s of impressions\n", pct(topShare(values, 0.10), 1))
+	_ = tw.Flush()
+	fmt.Println()
+
+	var fresh, established []exposure
+	var low, mid, high []exposure
+	for _, e := range all {
+		if e.isNew {
+			fresh = append(fresh, e)
+		} else {
+			established = append(established, e)
+		}
+		switch {
+		case e.rating < 950:
+			low = append(low, e)
+		case e.rating <= 1050:
+			mid = append(mid, e)
+		default:
+			high = append(high, e)
+		}
+	}
+
+	tw = tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "COHORT\tPROFILES\tSHOWN AT LEAST ONCE\tIMPRESSIONS\tSHARE\tMEDIAN\tP90")
+	for _, s := range []cohortStats{
+		cohort(fmt.Sprintf("new (< %d days)", *newDays), fresh),
+		cohort("established", established),
+		cohort("rating < 950", low),
+		cohort("rating 950-1050", mid),
+		cohort("rating > 1050", high),
+	} {
+		fmt.Fprintf(tw, "%s\t%d\t%s\t%d\t%s\t%d\t%d\n",
+			s.name, s.users, pct(float64(s.shown), float64(s.users)), s.total,
+			pct(float64(s.total), float64(total)), s.median, s.p90)
+	}
+	_ = tw.Flush()
+}
@@ -1,8 +1,12 @@
 package main
 
 import (
+	"fmt"
 	"log"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 )
@@ -12,8 +16,72 @@ type Config struct {
 	JWTSecret   string
 	DBURL       string
 	AllowOrigin string
+
+	// очередь рекомендаций
+	RecsQueueSize       int
+	RecsRefreshInterval time.Duration
+	RecsWorkerInterval  time.Duration
+
+	// свайпы
+	RewindDailyLimit        int
+	SuperLikeRefillAmount   int
+	SuperLikeRefillInterval time.Duration
+	LikesDailyLimit         int
+
+	// защита от ботов: слишком много лайков подряд
+	SwipeBurstLimit       int
+	SwipeBurstWindow      time.Duration
+	SwipeThrottleCooldown time.Duration
+
+	// буст профиля
+	BoostDuration    time.Duration
+	BoostWeeklyLimit int
+
+	// лог событий рекомендаций
+	EventBufferSize    int
+	EventBatchSize     int
+	EventFlushInterval time.Duration
+
+	// JSON с A/B экспериментами ранжирования
+	ExperimentsFile string
+
+	// коллаборативная фильтрация: со скольких лайков подмешивать
+	AffinityMinLikes int
+
+	// сколько показов в сутки у одной анкеты до штрафа в выдаче (0 — без лимита)
+	ExposureDailyCap int
+
+	// через сколько пропущенная анкета может вернуться (если её заметно поменяли); 0 — никогда
+	DislikeCooldown time.Duration
+
+	// со скольких жалоб от разных людей жалобы на юзера эскалируются (0 — никогда)
+	ReportEscalationThreshold int
+
+	// платные фичи, открытые всем (через запятую, например "likes_you")
+	FreeFeatures []string
+
+	// лимиты для тех, у кого фича есть в подписке
+	PremiumSuperLikeRefillAmount int
+	PremiumRewindDailyLimit      int
+	PremiumBoostWeeklyLimit      int
+
+	// платёжный провайдер подписок и секрет подписи его вебхуков; без провайдера платежи выключены
+	PaymentProvider      string
+	PaymentWebhookSecret string
+	// dev-режим платежей: только с ним можно выбрать "fake" и дёргать /me/subscription/simulate
+	PaymentsDevMode bool
+
+	// кто кому может писать: "matched" (матч, запрос по суперлайку, поддержка) или "open" — все всем
+	ChatPolicy string
+	// сколько сообщений можно отправить по суперлайку до матча (0 — без запросов)
+	ChatMessageRequestLimit int
+	// роли поддержки: они пишут кому угодно, им отвечают без матча
+	ChatSupportRoles []string
 }
 
+// appConfig — конфиг, доступный хендлерам (выставляется в main)
+var appConfig Config
+
 func LoadConfig() Config {
 	// загружаем .env (если есть)
 	_ = godotenv.Load()
@@ -43,8 +111,141 @@ func LoadConfig() Config {
 		JWTSecret:   jwtSecret,
 		DBURL:       dbURL,
 		AllowOrigin: origin,
+
+		RecsQueueSize:       envInt("RECS_QUEUE_SIZE", 100),
+		RecsRefreshInterval: envDuration("RECS_REFRESH_INTERVAL", 30*time.Minute),
+		RecsWorkerInterval:  envDuration("RECS_WORKER_INTERVAL", 15*time.Second),
+
+		RewindDailyLimit:        envInt("REWIND_DAILY_LIMIT", 3),
+		SuperLikeRefillAmount:   envInt("SUPERLIKE_REFILL_AMOUNT", 3),
+		SuperLikeRefillInterval: envDuration("SUPERLIKE_REFILL_INTERVAL", 24*time.Hour),
+		LikesDailyLimit:         envInt("LIKES_DAILY_LIMIT", 100),
+
+		SwipeBurstLimit:       envInt("SWIPE_BURST_LIMIT", 20),
+		SwipeBurstWindow:      envDuration("SWIPE_BURST_WINDOW", 10*time.Second),
+		SwipeThrottleCooldown: envDuration("SWIPE_THROTTLE_COOLDOWN", 5*time.Minute),
+
+		BoostDuration:    envDuration("BOOST_DURATION", 30*time.Minute),
+		BoostWeeklyLimit: envInt("BOOST_WEEKLY_LIMIT", 1),
+
+		EventBufferSize:    envInt("EVENT_BUFFER_SIZE", 10000),
+		EventBatchSize:     envInt("EVENT_BATCH_SIZE", 500),
+		EventFlushInterval: envDuration("EVENT_FLUSH_INTERVAL", 2*time.Second),
+
+		ExperimentsFile: envString("EXPERIMENTS_FILE", "experiments.json"),
+
+		AffinityMinLikes: envInt("AFFINITY_MIN_LIKES", 5),
+		ExposureDailyCap: envInt("EXPOSURE_DAILY_CAP", 500),
+		DislikeCooldown:  envDuration("DISLIKE_COOLDOWN", 30*24*time.Hour),
+
+		ReportEscalationThreshold: envInt("REPORT_ESCALATION_THRESHOLD", 3),
+
+		FreeFeatures: envList("FREE_FEATURES"),
+
+		PremiumSuperLikeRefillAmount: envInt("PREMIUM_SUPERLIKE_REFILL_AMOUNT", 5),
+		PremiumRewindDailyLimit:      envInt("PREMIUM_REWIND_DAILY_LIMIT", 20),
+		PremiumBoostWeeklyLimit:      envInt("PREMIUM_BOOST_WEEKLY_LIMIT", 3),
+
+		PaymentProvider:      os.Getenv("PAYMENT_PROVIDER"),
+		PaymentWebhookSecret: os.Getenv("PAYMENT_WEBHOOK_SECRET"),
+		PaymentsDevMode:      envBool("PAYMENTS_DEV_MODE", false),
+
+		ChatPolicy:              envString("CHAT_POLICY", "matched"),
+		ChatMessageRequestLimit: envInt("CHAT_MESSAGE_REQUEST_LIMIT", 1),
+		ChatSupportRoles:        envList("CHAT_SUPPORT_ROLES"),
+	}
+	if len(cfg.ChatSupportRoles) == 0 {
+		cfg.ChatSupportRoles = []string{"MODERATOR"}
+	}
+	if err := cfg.validate(); err != nil {
+		log.Fatalf("Config: %v", err)
 	}
 
 	log.Printf("Config: PORT=%s, ALLOW_ORIGIN=%s", cfg.Port, cfg.AllowOrigin)
 	return cfg
 }
+
+// validate — то, с чем сервер работать не сможет: интервалы фоновых воркеров
+// идут в time.NewTicker, а он паникует на нуле и отрицательных значениях
+func (c Config) validate() error {
+	intervals := []struct {
+		key string
+		v   time.Duration
+	}{
+		{"RECS_WORKER_INTERVAL", c.RecsWorkerInterval},
+		{"RECS_REFRESH_INTERVAL", c.RecsRefreshInterval},
+		{"SUPERLIKE_REFILL_INTERVAL", c.SuperLikeRefillInterval},
+		{"EVENT_FLUSH_INTERVAL", c.EventFlushInterval},
+	}
+	for _, it := range intervals {
+		if it.v <= 0 {
+			return fmt.Errorf("%s must be positive, got %s", it.key, it.v)
+		}
+	}
+
+	// без провайдера платежи просто выключены, но провайдер без секрета — ошибка
+	if c.PaymentProvider != "" && c.PaymentWebhookSecret == "" {
+		return fmt.Errorf("PAYMENT_WEBHOOK_SECRET is required with PAYMENT_PROVIDER=%s", c.PaymentProvider)
+	}
+	return nil
+}
+
+func envString(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
+
+// envInt читает целое из окружения, при ошибке — значение по умолчанию
+func envInt(key string, def int) int {
+	raw := os.Getenv(key)
+	if raw == "" {
+		return def
+	}
+	v, err := strconv.Atoi(raw)
+	if err != nil {
+		log.Printf("Config: invalid %s=%q, using %d", key, raw, def)
+		return def
+	}
+	return v
+}
+
+// envBool читает "true"/"false"/"1"/"0"
+func envBool(key string, def bool) bool {
+	raw := os.Getenv(key)
+	if raw == "" {
+		return def
+	}
+	v, err := strconv.ParseBool(raw)
+	if err != nil {
+		log.Printf("Config: invalid %s=%q, using %t", key, raw, def)
+		return def
+	}
+	return v
+}
+
+// envDuration читает длительность вида "30m", "24h"
+func envDuration(key string, def time.Duration) time.Duration {
+	raw := os.Getenv(key)
+	if raw == "" {
+		return def
+	}
+	v, err := time.ParseDuration(raw)
+	if err != nil {
+		log.Printf("Config: invalid %s=%q, using %s", key, raw, def)
+		return def
+	}
+	return v
+}
+
+// envList читает список через запятую; пустые элементы выкидываются
+func envList(key string) []string {
+	var out []string
+	for _, part := range strings.Split(os.Getenv(key), ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			out = append(out, part)
+		}
+	}
+	return out
+}
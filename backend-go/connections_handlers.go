@@ -2,14 +2,45 @@ package main
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"log"
 	"net/http"
 	"strconv"
 	"time"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
 )
 
-// GET /connections -> { connections: number[] }
+// ===== списки матчей и входящих лайков =====
+
+type connectionCard struct {
+	ConnectionID int64               `json:"connectionId"`
+	UserID       int64               `json:"userId"`
+	Name         string              `json:"name"`
+	AvatarURL    *string             `json:"avatarUrl"`
+	MatchedAt    time.Time           `json:"matchedAt"`
+	ChatID       *int64              `json:"chatId"`
+	LastMessage  *lastMessagePreview `json:"lastMessage"`
+	Online       bool                `json:"online"`
+}
+
+type lastMessagePreview struct {
+	Content   string    `json:"content"`
+	SenderID  int64     `json:"senderId"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+var connectionSorts = map[string]keysetSort{
+	// свежие матчи первыми
+	"recent": {keys: []string{`cs."matchedAt"`}, types: []string{"timestamptz"}, id: `cs."id"`, desc: true},
+	// по последней активности в чате (без сообщений — по времени матча)
+	"activity": {keys: []string{`COALESCE(lm."timestamp", cs."matchedAt")`}, types: []string{"timestamptz"}, id: `cs."id"`, desc: true},
+	"name":     {keys: []string{`lower(u."name")`}, types: []string{"text"}, id: `cs."id"`},
+}
+
+// GET /connections?sort=recent|activity|name&limit=&cursor=
 func handleGetConnections(w http.ResponseWriter, r *http.Request) {
 	userID, ok := getUserIDFromContext(r)
 	if !ok {
@@ -17,45 +48,117 @@ func handleGetConnections(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	page, msg := parsePageParams(r, connectionSorts, "recent")
+	if msg != "" {
+		writeError(w, http.StatusBadRequest, msg)
+		return
+	}
+
 	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
 	defer cancel()
 
-	rows, err := db.Query(ctx, `
-		SELECT "fromUserId","toUserId"
-		FROM "Connection"
-		WHERE "status" = 'MATCHED'
-		  AND ("fromUserId" = $1 OR "toUserId" = $1)
-	`, userID)
+	rows, err := db.Query(ctx, fmt.Sprintf(`
+		SELECT cs."id", u."id", u."name",
+		       (SELECT p."url" FROM "Photo" p WHERE p."userId" = u."id" ORDER BY p."id" LIMIT 1),
+		       cs."matchedAt", ch."chatId",
+		       lm."content", lm."senderId", lm."timestamp",
+		       %s
+		FROM "ConnectionSide" cs
+		JOIN "User" u ON u."id" = cs."otherUserId"
+		LEFT JOIN LATERAL (
+			SELECT cu1."chatId"
+			FROM "ChatUser" cu1
+			JOIN "ChatUser" cu2 ON cu2."chatId" = cu1."chatId" AND cu2."userId" = cs."otherUserId"
+			JOIN "Chat" c ON c."id" = cu1."chatId" AND c."kind" = 'DIRECT'
+			WHERE cu1."userId" = $1
+			ORDER BY cu1."chatId" DESC
+			LIMIT 1
+		) ch ON TRUE
+		LEFT JOIN LATERAL (
+			SELECT m."content", m."senderId", m."timestamp"
+			FROM "Message" m
+			WHERE m."chatId" = ch."chatId"
+			ORDER BY m."timestamp" DESC
+			LIMIT 1
+		) lm ON TRUE
+		WHERE cs."userId" = $1
+		  AND cs."matchedAt" IS NOT NULL
+		  AND NOT EXISTS (
+			SELECT 1 FROM "Block" b
+			WHERE (b."blockerId" = $1 AND b."blockedId" = cs."otherUserId")
+			   OR (b."blockerId" = cs."otherUserId" AND b."blockedId" = $1)
+		  )
+		  AND %s
+		ORDER BY %s
+		LIMIT $4
+	`, page.sort.cursorKeys(), page.sort.after(2), page.sort.orderBy()),
+		userID, page.cursorKeys, page.cursorID, page.limit+1)
 	if err != nil {
 		writeError(w, http.StatusInternalServerError, "Failed to load connections")
 		return
 	}
-	defer rows.Close()
 
-	idsMap := map[int64]bool{}
-	for rows.Next() {
-		var fromID, toID int64
-		if err := rows.Scan(&fromID, &toID); err != nil {
-			continue
-		}
-		if fromID == userID {
-			idsMap[toID] = true
-		} else {
-			idsMap[fromID] = true
+	var lastKeys [][]string
+	cards, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (connectionCard, error) {
+		var c connectionCard
+		var content *string
+		var senderID *int64
+		var sentAt *time.Time
+		var keys []string
+		err := row.Scan(&c.ConnectionID, &c.UserID, &c.Name, &c.AvatarURL, &c.MatchedAt, &c.ChatID,
+			&content, &senderID, &sentAt, &keys)
+		if content != nil && senderID != nil && sentAt != nil {
+			c.LastMessage = &lastMessagePreview{Content: *content, SenderID: *senderID, Timestamp: *sentAt}
 		}
+		c.Online = isUserOnline(c.UserID)
+		lastKeys = append(lastKeys, keys)
+		return c, err
+	})
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to load connections")
+		return
 	}
 
-	var ids []int64
-	for id := range idsMap {
-		ids = append(ids, id)
+	var nextCursor *string
+	if len(cards) > page.limit {
+		cards = cards[:page.limit]
+		cur := encodeCursor(page.sortName, lastKeys[page.limit-1], cards[page.limit-1].ConnectionID)
+		nextCursor = &cur
+	}
+	if cards == nil {
+		cards = []connectionCard{}
 	}
 
 	writeJSON(w, http.StatusOK, map[string]interface{}{
-		"connections": ids,
+		"connections": cards,
+		"nextCursor":  nextCursor,
 	})
 }
 
-// GET /connections/requests
+type connectionRequestCard struct {
+	ID        int64     `json:"id"`
+	FromUser  int64     `json:"fromUserId"`
+	ToUser    int64     `json:"toUserId"`
+	Status    string    `json:"status"`
+	Name      string    `json:"name"`
+	AvatarURL *string   `json:"avatarUrl"`
+	LikedAt   time.Time `json:"likedAt"`
+	Online    bool      `json:"online"`
+}
+
+var connectionRequestSorts = map[string]keysetSort{
+	// суперлайки первыми, дальше свежие
+	"superlikes": {
+		keys:  []string{`(cs."otherAction" = 'SUPERLIKED')`, `cs."otherActedAt"`},
+		types: []string{"boolean", "timestamptz"},
+		id:    `cs."id"`,
+		desc:  true,
+	},
+	"recent": {keys: []string{`cs."otherActedAt"`}, types: []string{"timestamptz"}, id: `cs."id"`, desc: true},
+	"name":   {keys: []string{`lower(u."name")`}, types: []string{"text"}, id: `cs."id"`},
+}
+
+// GET /connections/requests?sort=superlikes|recent|name&limit=&cursor=
 func handleGetConnectionRequests(w http.ResponseWriter, r *http.Request) {
 	userID, ok := getUserIDFromContext(r)
 	if !ok {
@@ -63,48 +166,100 @@ func handleGetConnectionRequests(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	page, msg := parsePageParams(r, connectionRequestSorts, "superlikes")
+	if msg != "" {
+		writeError(w, http.StatusBadRequest, msg)
+		return
+	}
+
 	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
 	defer cancel()
 
-	rows, err := db.Query(ctx, `
-		SELECT "id","fromUserId","toUserId","status"
-		FROM "Connection"
-		WHERE "toUserId" = $1
-		  AND "status" IN ('LIKED','SUPERLIKED')
-	`, userID)
+	// кто поставил обычный лайк — платная фича, как и в /me/likes
+	entitled, err := HasEntitlement(ctx, userID, featureLikesYou)
 	if err != nil {
-		writeError(w, http.StatusInternalServerError, "Failed to load requests")
+		writeError(w, http.StatusInternalServerError, "Failed to check subscription")
 		return
 	}
-	defer rows.Close()
 
-	type req struct {
-		ID       int64  `json:"id"`
-		FromUser int64  `json:"fromUserId"`
-		ToUser   int64  `json:"toUserId"`
-		Status   string `json:"status"`
+	out, nextCursor, err := loadIncomingLikes(ctx, userID, page, !entitled)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to load requests")
+		return
 	}
-	var out []req
 
-	for rows.Next() {
-		var rItem req
-		if err := rows.Scan(&rItem.ID, &rItem.FromUser, &rItem.ToUser, &rItem.Status); err != nil {
-			continue
-		}
-		out = append(out, rItem)
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"requests":   out,
+		"locked":     !entitled,
+		"nextCursor": nextCursor,
+	})
+}
+
+// loadIncomingLikes — страница неотвеченных входящих лайков; onlySuper — только суперлайки
+func loadIncomingLikes(ctx context.Context, userID int64, page pageParams, onlySuper bool) ([]connectionRequestCard, *string, error) {
+	rows, err := db.Query(ctx, fmt.Sprintf(`
+		SELECT cs."id", cs."otherUserId", cs."userId", cs."otherAction",
+		       u."name",
+		       (SELECT p."url" FROM "Photo" p WHERE p."userId" = u."id" ORDER BY p."id" LIMIT 1),
+		       cs."otherActedAt",
+		       %s
+		FROM "ConnectionSide" cs
+		JOIN "User" u ON u."id" = cs."otherUserId"
+		WHERE cs."userId" = $1
+		  AND cs."otherAction" IN ('LIKED','SUPERLIKED')
+		  AND (NOT $5 OR cs."otherAction" = 'SUPERLIKED')
+		  AND cs."action" IS NULL
+		  AND cs."matchedAt" IS NULL
+		  AND NOT EXISTS (
+			SELECT 1 FROM "Block" b
+			WHERE (b."blockerId" = $1 AND b."blockedId" = cs."otherUserId")
+			   OR (b."blockerId" = cs."otherUserId" AND b."blockedId" = $1)
+		  )
+		  AND %s
+		ORDER BY %s
+		LIMIT $4
+	`, page.sort.cursorKeys(), page.sort.after(2), page.sort.orderBy()),
+		userID, page.cursorKeys, page.cursorID, page.limit+1, onlySuper)
+	if err != nil {
+		return nil, nil, err
 	}
 
-	writeJSON(w, http.StatusOK, map[string]interface{}{
-		"requests": out,
+	var lastKeys [][]string
+	out, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (connectionRequestCard, error) {
+		var c connectionRequestCard
+		var keys []string
+		err := row.Scan(&c.ID, &c.FromUser, &c.ToUser, &c.Status, &c.Name, &c.AvatarURL, &c.LikedAt, &keys)
+		c.Online = isUserOnline(c.FromUser)
+		lastKeys = append(lastKeys, keys)
+		return c, err
 	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var nextCursor *string
+	if len(out) > page.limit {
+		out = out[:page.limit]
+		cur := encodeCursor(page.sortName, lastKeys[page.limit-1], out[page.limit-1].ID)
+		nextCursor = &cur
+	}
+	if out == nil {
+		out = []connectionRequestCard{}
+	}
+	return out, nextCursor, nil
 }
 
 func handleLikeUser(w http.ResponseWriter, r *http.Request) {
-	handleConnectionAction(w, r, "LIKED", true)
+	handleConnectionAction(w, r, connLiked)
 }
 
 func handleDislikeUser(w http.ResponseWriter, r *http.Request) {
-	handleConnectionAction(w, r, "DISLIKED", false)
+	handleConnectionAction(w, r, connDisliked)
+}
+
+// суперлайк тоже может сразу дать матч, если нас уже лайкнули
+func handleSuperLikeUser(w http.ResponseWriter, r *http.Request) {
+	handleConnectionAction(w, r, connSuperLiked)
 }
 
 func handleAcceptConnection(w http.ResponseWriter, r *http.Request) {
@@ -129,38 +284,42 @@ func handleAcceptConnection(w http.ResponseWriter, r *http.Request) {
 	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
 	defer cancel()
 
-	// есть ли коннекшен target -> me
-	var connID int64
-	err = db.QueryRow(ctx, `
-		SELECT "id"
-		FROM "Connection"
-		WHERE "fromUserId" = $1
-		  AND "toUserId" = $2
-		  AND "status" IN ('LIKED','SUPERLIKED','PENDING')
-	`, targetID, userID).Scan(&connID)
+	tx, err := db.Begin(ctx)
 	if err != nil {
-		writeError(w, http.StatusNotFound, "No pending request from this user")
+		writeError(w, http.StatusInternalServerError, "Failed to start transaction")
 		return
 	}
+	defer tx.Rollback(ctx)
 
-	_, err = db.Exec(ctx, `
-		UPDATE "Connection"
-		SET "status" = 'MATCHED'
-		WHERE "id" = $1
-	`, connID)
+	res, err := connectionsIn(tx).Accept(ctx, userID, targetID)
 	if err != nil {
+		writeConnectionError(w, err, "Failed to update connection")
+		return
+	}
+	if err := recordRatingVote(ctx, tx, userID, targetID, true); err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to update rating")
+		return
+	}
+	if err := tx.Commit(ctx); err != nil {
 		writeError(w, http.StatusInternalServerError, "Failed to update connection")
 		return
 	}
 
 	// создаём (или находим существующий) чат для этой пары
-	_, _ = ensureChatForUsers(ctx, userID, targetID)
+	chatID, err := ensureChatForUsers(ctx, userID, targetID)
+	if err != nil {
+		log.Printf("accept %d -> %d: ensure chat: %v", targetID, userID, err)
+	}
+	markRecommendationsStale(ctx, userID, targetID)
+	logMatchEvents(userID, targetID)
+	wsNotifyMatch(ctx, userID, targetID, chatID)
 
 	writeJSON(w, http.StatusOK, map[string]interface{}{
-		"id":         connID,
-		"fromUserId": targetID,
-		"toUserId":   userID,
-		"status":     "MATCHED",
+		"id":         res.ID,
+		"fromUserId": res.FromUserID,
+		"toUserId":   res.ToUserID,
+		"status":     res.Status,
+		"chatId":     chatID,
 	})
 }
 
@@ -185,39 +344,59 @@ func handleRejectConnection(w http.ResponseWriter, r *http.Request) {
 	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
 	defer cancel()
 
-	var connID int64
-	err = db.QueryRow(ctx, `
-		SELECT "id"
-		FROM "Connection"
-		WHERE "fromUserId" = $1
-		  AND "toUserId" = $2
-		  AND "status" IN ('LIKED','SUPERLIKED','PENDING')
-	`, targetID, userID).Scan(&connID)
+	tx, err := db.Begin(ctx)
 	if err != nil {
-		writeError(w, http.StatusNotFound, "No pending request from this user")
+		writeError(w, http.StatusInternalServerError, "Failed to start transaction")
 		return
 	}
+	defer tx.Rollback(ctx)
 
-	_, err = db.Exec(ctx, `
-		UPDATE "Connection"
-		SET "status" = 'DISLIKED'
-		WHERE "id" = $1
-	`, connID)
+	res, err := connectionsIn(tx).Reject(ctx, userID, targetID)
 	if err != nil {
+		writeConnectionError(w, err, "Failed to update connection")
+		return
+	}
+	if err := recordRatingVote(ctx, tx, userID, targetID, false); err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to update rating")
+		return
+	}
+	if err := tx.Commit(ctx); err != nil {
 		writeError(w, http.StatusInternalServerError, "Failed to update connection")
 		return
 	}
 
+	markRecommendationsStale(ctx, userID, targetID)
+	logSwipeEvents(userID, targetID, "DISLIKED", false)
+
 	writeJSON(w, http.StatusOK, map[string]interface{}{
-		"id":         connID,
-		"fromUserId": targetID,
-		"toUserId":   userID,
-		"status":     "DISLIKED",
+		"id":         res.ID,
+		"fromUserId": res.FromUserID,
+		"toUserId":   res.ToUserID,
+		"status":     res.Status,
 	})
 }
 
+// writeConnectionError — типизированные ошибки connectionService в HTTP-ответ
+func writeConnectionError(w http.ResponseWriter, err error, fallback string) {
+	var transition *connTransitionError
+	switch {
+	case errors.Is(err, errConnUserNotFound):
+		writeError(w, http.StatusNotFound, "User not found")
+	case errors.Is(err, errNoPendingRequest):
+		writeError(w, http.StatusNotFound, "No pending request from this user")
+	case errors.Is(err, errConnectionNotFound):
+		writeError(w, http.StatusNotFound, "Connection not found")
+	case errors.Is(err, errAlreadySuperLiked):
+		writeError(w, http.StatusConflict, "You already super-liked this user")
+	case errors.As(err, &transition):
+		writeError(w, http.StatusConflict, transition.Error())
+	default:
+		writeError(w, http.StatusInternalServerError, fallback)
+	}
+}
+
 // общий helper для like / dislike / superlike
-func handleConnectionAction(w http.ResponseWriter, r *http.Request, status string, checkMatch bool) {
+func handleConnectionAction(w http.ResponseWriter, r *http.Request, status string) {
 	userID, ok := getUserIDFromContext(r)
 	if !ok {
 		writeError(w, http.StatusUnauthorized, "Authentication required")
@@ -235,70 +414,115 @@ func handleConnectionAction(w http.ResponseWriter, r *http.Request, status strin
 		return
 	}
 
+	// свайпы вправо с нечеловеческой скоростью — тормозим
+	if status == connLiked || status == connSuperLiked {
+		if retryAfter, ok := rightSwipes.allow(userID, time.Now()); !ok {
+			w.Header().Set("Retry-After", strconv.Itoa(int(retryAfter.Seconds())+1))
+			writeError(w, http.StatusTooManyRequests, "Too many likes, slow down")
+			return
+		}
+	}
+
 	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
 	defer cancel()
 
-	// таргет существует?
-	var tmp int64
-	if err := db.QueryRow(ctx, `SELECT "id" FROM "User" WHERE "id" = $1`, targetID).Scan(&tmp); err != nil {
-		writeError(w, http.StatusNotFound, "User not found")
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to start transaction")
 		return
 	}
+	defer tx.Rollback(ctx)
 
-	// если checkMatch = true (like), смотрим, лайкал ли он нас ранее
-	if checkMatch {
-		var reverseStatus string
-		err := db.QueryRow(ctx, `
-			SELECT "status"
-			FROM "Connection"
-			WHERE "fromUserId" = $1 AND "toUserId" = $2
-		`, targetID, userID).Scan(&reverseStatus)
-		if err == nil && (reverseStatus == "LIKED" || reverseStatus == "SUPERLIKED" || reverseStatus == "PENDING") {
-			// это матч
-			_, err = db.Exec(ctx, `
-				UPDATE "Connection"
-				SET "status" = 'MATCHED'
-				WHERE "fromUserId" = $1 AND "toUserId" = $2
-			`, targetID, userID)
+	// суперлайк списывается в той же транзакции, что и сам коннекшен
+	superLikesLeft := -1
+	if status == connSuperLiked {
+		superLikesLeft, err = consumeSuperLike(ctx, tx, userID, targetID)
+		switch {
+		case errors.Is(err, errAlreadySuperLiked):
+			writeError(w, http.StatusConflict, "You already super-liked this user")
+			return
+		case errors.Is(err, errNoSuperLikesLeft):
+			writeError(w, http.StatusTooManyRequests, "No super-likes left")
+			return
+		case err != nil:
+			writeError(w, http.StatusInternalServerError, "Failed to use super-like")
+			return
+		}
+	}
+
+	res, err := connectionsIn(tx).Swipe(ctx, userID, targetID, status)
+	if err != nil {
+		writeConnectionError(w, err, "Failed to upsert connection")
+		return
+	}
+
+	// повторный лайк того же юзера (ретрай, двойной клик) — ни лимит, ни рейтинг не трогаем;
+	// при исчерпанном лимите транзакция откатывается вместе со свайпом
+	likesLeft := -1
+	if res.Changed {
+		if status == connLiked {
+			likesLeft, err = consumeDailyLike(ctx, tx, userID)
+			if errors.Is(err, errDailyLikeLimit) {
+				writeError(w, http.StatusTooManyRequests, "Daily like limit reached")
+				return
+			}
 			if err != nil {
-				writeError(w, http.StatusInternalServerError, "Failed to update connection")
+				writeError(w, http.StatusInternalServerError, "Failed to check like limit")
 				return
 			}
-
-			// создаём чат для пары (если ещё нет)
-			_, _ = ensureChatForUsers(ctx, userID, targetID)
-
-			writeJSON(w, http.StatusOK, map[string]interface{}{
-				"matched":    true,
-				"fromUserId": targetID,
-				"toUserId":   userID,
-				"status":     "MATCHED",
-			})
+		}
+		if err := recordRatingVote(ctx, tx, userID, targetID, status != connDisliked); err != nil {
+			writeError(w, http.StatusInternalServerError, "Failed to update rating")
 			return
 		}
 	}
-
-	// upsert from me -> target
-	var id int64
-	err = db.QueryRow(ctx, `
-		INSERT INTO "Connection" ("fromUserId","toUserId","status")
-		VALUES ($1,$2,$3)
-		ON CONFLICT ("fromUserId","toUserId") DO UPDATE SET
-			"status" = EXCLUDED."status"
-		RETURNING "id"
-	`, userID, targetID, status).Scan(&id)
-	if err != nil {
+	if err := tx.Commit(ctx); err != nil {
 		writeError(w, http.StatusInternalServerError, "Failed to upsert connection")
 		return
 	}
 
-	writeJSON(w, http.StatusOK, map[string]interface{}{
-		"id":         id,
-		"fromUserId": userID,
-		"toUserId":   targetID,
-		"status":     status,
+	markRecommendationsStale(ctx, userID, targetID)
+	if res.Changed {
+		logSwipeEvents(userID, targetID, status, res.Matched)
+	}
+
+	if res.Matched {
+		// создаём чат для пары (если ещё нет)
+		chatID, err := ensureChatForUsers(ctx, userID, targetID)
+		if err != nil {
+			log.Printf("match %d <-> %d: ensure chat: %v", userID, targetID, err)
+		}
+		wsNotifyMatch(ctx, userID, targetID, chatID)
+
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"matched":    true,
+			"fromUserId": res.FromUserID,
+			"toUserId":   res.ToUserID,
+			"status":     res.Status,
+			"chatId":     chatID,
+		})
+		return
+	}
+
+	// суперлайк — тот же like_received со статусом SUPERLIKED, отдельного события нет
+	if res.Changed && (status == connLiked || status == connSuperLiked) {
+		wsNotifyLikeReceived(ctx, res)
+	}
+
+	resp := map[string]interface{}{
+		"id":         res.ID,
+		"fromUserId": res.FromUserID,
+		"toUserId":   res.ToUserID,
+		"status":     res.Status,
 		"matched":    false,
-	})
+	}
+	if superLikesLeft >= 0 {
+		resp["superLikesLeft"] = superLikesLeft
+	}
+	if likesLeft >= 0 {
+		resp["likesLeft"] = likesLeft
+	}
+	writeJSON(w, http.StatusOK, resp)
 }
 
 // POST /connections/:id/disconnect
@@ -323,31 +547,35 @@ func handleDisconnectConnection(w http.ResponseWriter, r *http.Request) {
 	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
 	defer cancel()
 
-	// таргет есть?
-	var tmp int64
-	if err := db.QueryRow(ctx, `SELECT "id" FROM "User" WHERE "id" = $1`, targetID).Scan(&tmp); err != nil {
-		writeError(w, http.StatusNotFound, "User not found")
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to start transaction")
 		return
 	}
+	defer tx.Rollback(ctx)
 
-	res, err := db.Exec(ctx, `
-		UPDATE "Connection"
-		SET "status" = 'DISLIKED'
-		WHERE ("fromUserId" = $1 AND "toUserId" = $2)
-		   OR ("fromUserId" = $2 AND "toUserId" = $1)
-	`, userID, targetID)
+	res, err := connectionsIn(tx).Disconnect(ctx, userID, targetID)
 	if err != nil {
-		writeError(w, http.StatusInternalServerError, "Failed to update connections")
+		writeConnectionError(w, err, "Failed to update connections")
 		return
 	}
-	affected := res.RowsAffected()
-	if affected == 0 {
-		writeError(w, http.StatusNotFound, "Connection not found")
+	if err := tx.Commit(ctx); err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to update connections")
 		return
 	}
+	markRecommendationsStale(ctx, userID, targetID)
+	if res.unmatched {
+		wsNotifyUnmatched(userID, targetID, res.chatIDs)
+	}
 
+	closedChats := res.chatIDs
+	if closedChats == nil {
+		closedChats = []int64{}
+	}
 	writeJSON(w, http.StatusOK, map[string]interface{}{
 		"disconnectedUserId": targetID,
+		"unmatched":          res.unmatched,
+		"closedChatIds":      closedChats,
 	})
 }
 
@@ -358,22 +586,37 @@ func ensureChatForUsers(ctx context.Context, user1, user2 int64) (int64, error)
 		return 0, nil
 	}
 
+	blocked, err := isBlockedBetween(ctx, db, user1, user2)
+	if err != nil {
+		return 0, err
+	}
+	if blocked {
+		return 0, errUserBlocked
+	}
+
 	var chatID int64
 
 	// пробуем найти существующий 1-1 чат
-	err := db.QueryRow(ctx, `
+	err = db.QueryRow(ctx, `
 		SELECT c."id"
 		FROM "Chat" c
 		JOIN "ChatUser" cu1 ON cu1."chatId" = c."id" AND cu1."userId" = $1
 		JOIN "ChatUser" cu2 ON cu2."chatId" = c."id" AND cu2."userId" = $2
+		WHERE c."kind" = 'DIRECT'
 		LIMIT 1
 	`, user1, user2).Scan(&chatID)
 	if err == nil && chatID > 0 {
 		return chatID, nil
 	}
 
-	// создаём новый чат
-	err = db.QueryRow(ctx, `
+	// создаём новый чат вместе с участниками, чтобы не остался пустой
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	err = tx.QueryRow(ctx, `
 		INSERT INTO "Chat" DEFAULT VALUES
 		RETURNING "id"
 	`).Scan(&chatID)
@@ -381,8 +624,8 @@ func ensureChatForUsers(ctx context.Context, user1, user2 int64) (int64, error)
 		return 0, err
 	}
 
-	_, err = db.Exec(ctx, `
-		INSERT INTO "Chat" ("chatId","userId")
+	_, err = tx.Exec(ctx, `
+		INSERT INTO "ChatUser" ("chatId","userId")
 		VALUES ($1,$2),($1,$3)
 		ON CONFLICT DO NOTHING
 	`, chatID, user1, user2)
@@ -390,5 +633,5 @@ func ensureChatForUsers(ctx context.Context, user1, user2 int64) (int64, error)
 		return 0, err
 	}
 
-	return chatID, nil
+	return chatID, tx.Commit(ctx)
 }
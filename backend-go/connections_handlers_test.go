@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func swipeRequest(t *testing.T, ctx context.Context, userID, targetID int64, status string) int {
+	t.Helper()
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add("id", strconv.FormatInt(targetID, 10))
+	ctx = context.WithValue(context.WithValue(ctx, chi.RouteCtxKey, rctx), ctxUserIDKey, userID)
+
+	rec := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, "/connections/"+strconv.FormatInt(targetID, 10), nil).WithContext(ctx)
+	handleConnectionAction(rec, r, status)
+	return rec.Code
+}
+
+// повторный лайк не списывает ещё один дневной лайк и не голосует в рейтинг второй раз
+func TestRepeatLikeIsFree(t *testing.T) {
+	ctx := setupTestDB(t)
+	prev := appConfig
+	appConfig.LikesDailyLimit = 5
+	t.Cleanup(func() { appConfig = prev })
+
+	a, b := createTestUser(t, ctx), createTestUser(t, ctx)
+	for i := 0; i < 2; i++ {
+		if code := swipeRequest(t, ctx, a, b, connLiked); code != http.StatusOK {
+			t.Fatalf("like %d: status %d", i+1, code)
+		}
+	}
+
+	var likes int
+	err := db.QueryRow(ctx, `SELECT COALESCE(SUM("likes"), 0) FROM "DailyLikeCount" WHERE "userId" = $1`, a).Scan(&likes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if likes != 1 {
+		t.Fatalf("daily likes used: %d, want 1", likes)
+	}
+
+	var votes int
+	err = db.QueryRow(ctx, `SELECT "votes" FROM "UserRating" WHERE "userId" = $1`, b).Scan(&votes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if votes != 1 {
+		t.Fatalf("rating votes for the target: %d, want 1", votes)
+	}
+}
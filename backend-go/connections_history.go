@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// ===== история коннекшенов =====
+//
+// Лента строится по журналу "ConnectionTransition", который пишет
+// connectionService. Юзер видит свои действия целиком, а чужие — только лайки,
+// матчи и разрывы матча: кто его пропустил или отклонил, не показываем.
+// Чужой обычный лайк до матча — без featureLikesYou скрыт, как в /me/likes.
+// Модераторы видят журнал полностью, со статусами до и после.
+
+type connectionHistoryEvent struct {
+	ID         int64     `json:"id"`
+	Event      string    `json:"event"`
+	UserID     int64     `json:"userId"` // другая сторона пары
+	ActorID    int64     `json:"actorId"`
+	ByMe       bool      `json:"byMe"`
+	FromStatus *string   `json:"fromStatus,omitempty"`
+	ToStatus   *string   `json:"toStatus,omitempty"`
+	At         time.Time `json:"at"`
+}
+
+type connectionHistoryQuery struct {
+	withUserID *int64 // только эта пара
+	before     int64  // курсор: id события, 0 — с начала
+	limit      int
+	full       bool // для модераторов: все события, статусы и блоки
+	hideLikes  bool // скрыть чужие LIKED в парах, которые ни разу не матчились
+}
+
+// parseConnectionHistoryQuery — ?userId=&before=&limit=
+func parseConnectionHistoryQuery(r *http.Request) connectionHistoryQuery {
+	q := r.URL.Query()
+	out := connectionHistoryQuery{limit: 50}
+	if l, err := strconv.Atoi(q.Get("limit")); err == nil && l > 0 && l <= 200 {
+		out.limit = l
+	}
+	if b, err := strconv.ParseInt(q.Get("before"), 10, 64); err == nil && b > 0 {
+		out.before = b
+	}
+	if u, err := strconv.ParseInt(q.Get("userId"), 10, 64); err == nil && u > 0 {
+		out.withUserID = &u
+	}
+	return out
+}
+
+func loadConnectionHistory(ctx context.Context, userID int64, hq connectionHistoryQuery) ([]connectionHistoryEvent, bool, error) {
+	rows, err := db.Query(ctx, `
+		SELECT t."id", t."event",
+		       CASE WHEN t."userAId" = $1 THEN t."userBId" ELSE t."userAId" END,
+		       t."actorId", t."fromStatus", t."toStatus", t."createdAt"
+		FROM "ConnectionTransition" t
+		WHERE (t."userAId" = $1 OR t."userBId" = $1)
+		  AND ($2::bigint IS NULL OR (
+			t."userAId" = LEAST($1::bigint, $2::bigint) AND t."userBId" = GREATEST($1::bigint, $2::bigint)
+		  ))
+		  AND ($3::bigint = 0 OR t."id" < $3)
+		  AND ($4 OR t."actorId" = $1 OR t."event" IN ('LIKED','SUPERLIKED','MATCHED','UNMATCHED'))
+		  AND (NOT $6 OR t."actorId" = $1 OR t."event" <> 'LIKED' OR EXISTS (
+			SELECT 1 FROM "ConnectionTransition" m
+			WHERE m."userAId" = t."userAId" AND m."userBId" = t."userBId" AND m."event" = 'MATCHED'
+		  ))
+		  AND ($4 OR NOT EXISTS (
+			SELECT 1 FROM "Block" b
+			WHERE (b."blockerId" = t."userAId" AND b."blockedId" = t."userBId")
+			   OR (b."blockerId" = t."userBId" AND b."blockedId" = t."userAId")
+		  ))
+		ORDER BY t."id" DESC
+		LIMIT $5
+	`, userID, hq.withUserID, hq.before, hq.full, hq.limit+1, hq.hideLikes)
+	if err != nil {
+		return nil, false, err
+	}
+	events, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (connectionHistoryEvent, error) {
+		var e connectionHistoryEvent
+		err := row.Scan(&e.ID, &e.Event, &e.UserID, &e.ActorID, &e.FromStatus, &e.ToStatus, &e.At)
+		e.ByMe = e.ActorID == userID
+		if !hq.full {
+			e.FromStatus, e.ToStatus = nil, nil
+		}
+		return e, err
+	})
+	if err != nil {
+		return nil, false, err
+	}
+
+	hasMore := len(events) > hq.limit
+	if hasMore {
+		events = events[:hq.limit]
+	}
+	if events == nil {
+		events = []connectionHistoryEvent{}
+	}
+	return events, hasMore, nil
+}
+
+func writeConnectionHistory(w http.ResponseWriter, events []connectionHistoryEvent, hasMore bool) {
+	var nextBefore *int64
+	if hasMore {
+		nextBefore = &events[len(events)-1].ID
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"events":     events,
+		"hasMore":    hasMore,
+		"nextBefore": nextBefore,
+	})
+}
+
+// GET /connections/history
+func handleGetConnectionHistory(w http.ResponseWriter, r *http.Request) {
+	userID, ok := getUserIDFromContext(r)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "Authentication required")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	entitled, err := HasEntitlement(ctx, userID, featureLikesYou)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to check subscription")
+		return
+	}
+
+	hq := parseConnectionHistoryQuery(r)
+	hq.hideLikes = !entitled
+	events, hasMore, err := loadConnectionHistory(ctx, userID, hq)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to load connection history")
+		return
+	}
+	writeConnectionHistory(w, events, hasMore)
+}
+
+// GET /moderation/users/{id}/connections — полный журнал юзера для поддержки
+func handleGetModerationConnectionHistory(w http.ResponseWriter, r *http.Request) {
+	targetID, ok := parseIDParam(r, "id")
+	if !ok {
+		writeError(w, http.StatusBadRequest, "Invalid user id")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	hq := parseConnectionHistoryQuery(r)
+	hq.full = true
+	events, hasMore, err := loadConnectionHistory(ctx, targetID, hq)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to load connection history")
+		return
+	}
+	writeConnectionHistory(w, events, hasMore)
+}
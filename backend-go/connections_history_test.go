@@ -0,0 +1,40 @@
+package main
+
+import "testing"
+
+// чужой лайк до матча без likes_you не раскрывается, после матча — виден
+func TestConnectionHistoryHidesIncomingLikes(t *testing.T) {
+	ctx := setupTestDB(t)
+	a, b := createTestUser(t, ctx), createTestUser(t, ctx)
+
+	if _, err := swipeInTx(ctx, a, b, connLiked); err != nil {
+		t.Fatal(err)
+	}
+	hasLikeFrom := func(hideLikes bool) bool {
+		t.Helper()
+		events, _, err := loadConnectionHistory(ctx, b, connectionHistoryQuery{limit: 50, hideLikes: hideLikes})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, e := range events {
+			if e.Event == connLiked && e.ActorID == a {
+				return true
+			}
+		}
+		return false
+	}
+
+	if hasLikeFrom(true) {
+		t.Fatal("pending like shown without likes_you")
+	}
+	if !hasLikeFrom(false) {
+		t.Fatal("pending like hidden with likes_you")
+	}
+
+	if _, err := swipeInTx(ctx, b, a, connLiked); err != nil {
+		t.Fatal(err)
+	}
+	if !hasLikeFrom(true) {
+		t.Fatal("like still hidden after the match")
+	}
+}
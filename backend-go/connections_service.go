@@ -0,0 +1,466 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// ===== состояние коннекшенов =====
+//
+// Все изменения "Connection" идут через connectionService: он знает, какие
+// переходы статусов допустимы, и перед любым изменением берёт advisory-лок
+// на пару юзеров. Поэтому два встречных лайка в одну и ту же секунду
+// сериализуются и второй из них гарантированно видит первый — матч не теряется.
+// Методы нужно вызывать внутри транзакции: лок держится до её конца.
+//
+// Пара хранится одной строкой (см. schema.sql): действие каждой стороны плюс
+// "matchedAt". Переходы ниже описаны для направления "я -> он": его статус —
+// MATCHED, если пара в матче, иначе моё действие.
+
+const (
+	connPending    = "PENDING"
+	connLiked      = "LIKED"
+	connSuperLiked = "SUPERLIKED"
+	connDisliked   = "DISLIKED"
+	connMatched    = "MATCHED"
+)
+
+var (
+	errConnUserNotFound   = errors.New("user not found")
+	errAlreadySuperLiked  = errors.New("already super-liked")
+	errNoSuperLikesLeft   = errors.New("no super-likes left")
+	errNoPendingRequest   = errors.New("no pending request")
+	errConnectionNotFound = errors.New("connection not found")
+	errInvalidTransition  = errors.New("invalid connection transition")
+)
+
+// connTransitionError — переход статуса, которого нет в connTransitions
+type connTransitionError struct {
+	From string // "" — строки ещё нет
+	To   string
+}
+
+func (e *connTransitionError) Error() string {
+	from := e.From
+	if from == "" {
+		from = "NONE"
+	}
+	return fmt.Sprintf("cannot change connection from %s to %s", from, e.To)
+}
+
+func (e *connTransitionError) Is(target error) bool {
+	return target == errInvalidTransition
+}
+
+// события журнала "ConnectionTransition" кроме самих свайпов (LIKED / SUPERLIKED / DISLIKED)
+const (
+	connEventMatched      = "MATCHED"
+	connEventRejected     = "REJECTED"
+	connEventUnmatched    = "UNMATCHED"
+	connEventDisconnected = "DISCONNECTED" // разрыв до матча
+	connEventUndone       = "UNDONE"
+)
+
+// допустимые переходы одного направления (from -> to). Из MATCHED свайпом
+// не выйти: разрыв матча (MATCHED -> DISLIKED) делает только Disconnect
+var connTransitions = map[string]map[string]bool{
+	"":             {connLiked: true, connSuperLiked: true, connDisliked: true},
+	connPending:    {connLiked: true, connSuperLiked: true, connDisliked: true, connMatched: true},
+	connLiked:      {connLiked: true, connSuperLiked: true, connDisliked: true, connMatched: true},
+	connSuperLiked: {connDisliked: true, connMatched: true},
+	connDisliked:   {connLiked: true, connSuperLiked: true, connDisliked: true},
+	connMatched:    {},
+}
+
+func checkConnTransition(from, to string) error {
+	if connTransitions[from][to] {
+		return nil
+	}
+	if from == connSuperLiked && to == connSuperLiked {
+		return errAlreadySuperLiked
+	}
+	return &connTransitionError{From: from, To: to}
+}
+
+// входящий лайк, который ещё ждёт ответа
+func isPendingLike(status string) bool {
+	return status == connLiked || status == connSuperLiked || status == connPending
+}
+
+type connectionActionResult struct {
+	ID         int64
+	FromUserID int64
+	ToUserID   int64
+	Status     string
+	Matched    bool
+	Changed    bool // false — повторный свайп с тем же действием, ничего не изменилось
+}
+
+type connectionService struct {
+	q dbtx
+}
+
+func connectionsIn(q dbtx) connectionService {
+	return connectionService{q: q}
+}
+
+// lockConnectionPair сериализует все изменения коннекшенов пары до конца транзакции
+func lockConnectionPair(ctx context.Context, q dbtx, a, b int64) error {
+	_, err := q.Exec(ctx, `
+		SELECT pg_advisory_xact_lock(hashtextextended(LEAST($1::bigint, $2::bigint) || ':' || GREATEST($1::bigint, $2::bigint), 0))
+	`, a, b)
+	return err
+}
+
+// connPair — строка пары глазами userID
+type connPair struct {
+	id      int64 // 0 — строки ещё нет
+	mine    string
+	theirs  string
+	matched bool
+}
+
+// статус направления "я -> он"
+func (p connPair) status() string {
+	if p.matched {
+		return connMatched
+	}
+	return p.mine
+}
+
+// колонки стороны userID в строке пары
+func pairSide(userID, otherID int64) (action, actedAt string) {
+	if userID < otherID {
+		return `"aAction"`, `"aActedAt"`
+	}
+	return `"bAction"`, `"bActedAt"`
+}
+
+// loadPair читает пару под FOR UPDATE
+func (s connectionService) loadPair(ctx context.Context, userID, otherID int64) (connPair, error) {
+	var p connPair
+	var mine, theirs *string
+	err := s.q.QueryRow(ctx, `
+		SELECT "id",
+		       CASE WHEN "userAId" = $1 THEN "aAction" ELSE "bAction" END,
+		       CASE WHEN "userAId" = $1 THEN "bAction" ELSE "aAction" END,
+		       "matchedAt" IS NOT NULL
+		FROM "Connection"
+		WHERE "userAId" = LEAST($1::bigint, $2::bigint)
+		  AND "userBId" = GREATEST($1::bigint, $2::bigint)
+		FOR UPDATE
+	`, userID, otherID).Scan(&p.id, &mine, &theirs, &p.matched)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return connPair{}, nil
+	}
+	if err != nil {
+		return connPair{}, err
+	}
+	p.mine, p.theirs = deref(mine), deref(theirs)
+	return p, nil
+}
+
+// setAction записывает действие userID в пару (создаёт строку, если её нет);
+// action == "" стирает действие
+func (s connectionService) setAction(ctx context.Context, p *connPair, userID, otherID int64, action string) error {
+	actionCol, actedCol := pairSide(userID, otherID)
+	var value *string
+	if action != "" {
+		value = &action
+	}
+
+	if p.id == 0 {
+		err := s.q.QueryRow(ctx, fmt.Sprintf(`
+			INSERT INTO "Connection" ("userAId","userBId",%s,%s)
+			VALUES (LEAST($1::bigint, $2::bigint), GREATEST($1::bigint, $2::bigint), $3, NOW())
+			RETURNING "id"
+		`, actionCol, actedCol), userID, otherID, value).Scan(&p.id)
+		if err != nil {
+			return err
+		}
+	} else {
+		_, err := s.q.Exec(ctx, fmt.Sprintf(`
+			UPDATE "Connection"
+			SET %s = $2,
+			    %s = CASE WHEN $2::text IS NULL THEN NULL ELSE NOW() END,
+			    "updatedAt" = NOW()
+			WHERE "id" = $1
+		`, actionCol, actedCol), p.id, value)
+		if err != nil {
+			return err
+		}
+	}
+	p.mine = action
+	return nil
+}
+
+// setMatched ставит или снимает матч; повторный матч снимает следы анматча
+// и открывает старый чат пары
+func (s connectionService) setMatched(ctx context.Context, p *connPair, userID, otherID int64, matched bool) error {
+	_, err := s.q.Exec(ctx, `
+		UPDATE "Connection"
+		SET "matchedAt" = CASE WHEN $2 THEN NOW() END,
+		    "unmatchedAt" = CASE WHEN $2 THEN NULL ELSE "unmatchedAt" END,
+		    "updatedAt" = NOW()
+		WHERE "id" = $1
+	`, p.id, matched)
+	if err != nil {
+		return err
+	}
+	if matched {
+		if err := reopenChatsBetween(ctx, s.q, userID, otherID); err != nil {
+			return err
+		}
+	}
+	p.matched = matched
+	return nil
+}
+
+// logTransition пишет переход в журнал; from/to — статус направления actor -> other
+func (s connectionService) logTransition(ctx context.Context, actorID, otherID int64, event, from, to string) error {
+	_, err := s.q.Exec(ctx, `
+		INSERT INTO "ConnectionTransition" ("userAId","userBId","actorId","event","fromStatus","toStatus")
+		VALUES (LEAST($1::bigint, $2::bigint), GREATEST($1::bigint, $2::bigint), $1, $3, NULLIF($4, ''), NULLIF($5, ''))
+	`, actorID, otherID, event, from, to)
+	return err
+}
+
+// Swipe — like / superlike / dislike от userID к targetID. Если target уже
+// лайкнул userID, лайк делает пару матчем.
+func (s connectionService) Swipe(ctx context.Context, userID, targetID int64, status string) (connectionActionResult, error) {
+	if status != connLiked && status != connSuperLiked && status != connDisliked {
+		return connectionActionResult{}, &connTransitionError{To: status}
+	}
+
+	// таргет существует?
+	var tmp int64
+	if err := s.q.QueryRow(ctx, `SELECT "id" FROM "User" WHERE "id" = $1`, targetID).Scan(&tmp); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return connectionActionResult{}, errConnUserNotFound
+		}
+		return connectionActionResult{}, err
+	}
+	// с заблокированными (в любую сторону) — как будто юзера нет
+	if blocked, err := isBlockedBetween(ctx, s.q, userID, targetID); err != nil {
+		return connectionActionResult{}, err
+	} else if blocked {
+		return connectionActionResult{}, errConnUserNotFound
+	}
+
+	if err := lockConnectionPair(ctx, s.q, userID, targetID); err != nil {
+		return connectionActionResult{}, err
+	}
+	p, err := s.loadPair(ctx, userID, targetID)
+	if err != nil {
+		return connectionActionResult{}, err
+	}
+
+	// матч уже есть — менять его можно только через disconnect
+	before := p.status()
+	if err := checkConnTransition(before, status); err != nil {
+		return connectionActionResult{}, err
+	}
+	if before == status {
+		return connectionActionResult{
+			ID:         p.id,
+			FromUserID: userID,
+			ToUserID:   targetID,
+			Status:     status,
+		}, nil
+	}
+	if err := s.setAction(ctx, &p, userID, targetID, status); err != nil {
+		return connectionActionResult{}, err
+	}
+	if err := s.logTransition(ctx, userID, targetID, status, before, status); err != nil {
+		return connectionActionResult{}, err
+	}
+
+	if status != connDisliked && isPendingLike(p.theirs) {
+		if err := s.setMatched(ctx, &p, userID, targetID, true); err != nil {
+			return connectionActionResult{}, err
+		}
+		if err := s.logTransition(ctx, userID, targetID, connEventMatched, status, connMatched); err != nil {
+			return connectionActionResult{}, err
+		}
+		return connectionActionResult{
+			ID:         p.id,
+			FromUserID: targetID,
+			ToUserID:   userID,
+			Status:     connMatched,
+			Matched:    true,
+			Changed:    true,
+		}, nil
+	}
+
+	return connectionActionResult{
+		ID:         p.id,
+		FromUserID: userID,
+		ToUserID:   targetID,
+		Status:     status,
+		Changed:    true,
+	}, nil
+}
+
+// answerRequest — ответ userID на входящий лайк от fromID: LIKED даёт матч, DISLIKED — отказ
+func (s connectionService) answerRequest(ctx context.Context, userID, fromID int64, action string) (connectionActionResult, error) {
+	if blocked, err := isBlockedBetween(ctx, s.q, userID, fromID); err != nil {
+		return connectionActionResult{}, err
+	} else if blocked {
+		return connectionActionResult{}, errNoPendingRequest
+	}
+
+	if err := lockConnectionPair(ctx, s.q, userID, fromID); err != nil {
+		return connectionActionResult{}, err
+	}
+	p, err := s.loadPair(ctx, userID, fromID)
+	if err != nil {
+		return connectionActionResult{}, err
+	}
+	if p.matched || !isPendingLike(p.theirs) {
+		return connectionActionResult{}, errNoPendingRequest
+	}
+	before := p.mine
+	if err := checkConnTransition(before, action); err != nil {
+		return connectionActionResult{}, err
+	}
+	if err := s.setAction(ctx, &p, userID, fromID, action); err != nil {
+		return connectionActionResult{}, err
+	}
+
+	status, event := action, connEventRejected
+	if action == connLiked {
+		if err := s.setMatched(ctx, &p, userID, fromID, true); err != nil {
+			return connectionActionResult{}, err
+		}
+		status, event = connMatched, connEventMatched
+	}
+	if err := s.logTransition(ctx, userID, fromID, event, before, status); err != nil {
+		return connectionActionResult{}, err
+	}
+
+	return connectionActionResult{
+		ID:         p.id,
+		FromUserID: fromID,
+		ToUserID:   userID,
+		Status:     status,
+		Matched:    p.matched,
+	}, nil
+}
+
+func (s connectionService) Accept(ctx context.Context, userID, fromID int64) (connectionActionResult, error) {
+	return s.answerRequest(ctx, userID, fromID, connLiked)
+}
+
+func (s connectionService) Reject(ctx context.Context, userID, fromID int64) (connectionActionResult, error) {
+	return s.answerRequest(ctx, userID, fromID, connDisliked)
+}
+
+// disconnectResult — что изменил Disconnect
+type disconnectResult struct {
+	changed   int64   // сколько сторон изменилось
+	unmatched bool    // был матч
+	chatIDs   []int64 // закрытые чаты пары
+}
+
+// Disconnect разрывает матч и переводит действия обеих сторон в DISLIKED.
+// Если был матч, в той же транзакции закрывает чат пары (только чтение,
+// у userID он скрыт) и помечает пару "unmatchedAt" — это убирает их друг у
+// друга из presence.
+func (s connectionService) Disconnect(ctx context.Context, userID, targetID int64) (disconnectResult, error) {
+	var res disconnectResult
+	var tmp int64
+	if err := s.q.QueryRow(ctx, `SELECT "id" FROM "User" WHERE "id" = $1`, targetID).Scan(&tmp); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return res, errConnUserNotFound
+		}
+		return res, err
+	}
+
+	if err := lockConnectionPair(ctx, s.q, userID, targetID); err != nil {
+		return res, err
+	}
+	p, err := s.loadPair(ctx, userID, targetID)
+	if err != nil {
+		return res, err
+	}
+	if p.id == 0 || (p.mine == "" && p.theirs == "") {
+		return res, errConnectionNotFound
+	}
+	// матч рвётся всегда, остальное — по обычным правилам
+	if !p.matched {
+		if err := checkConnTransition(p.status(), connDisliked); err != nil {
+			return res, err
+		}
+	}
+
+	_, err = s.q.Exec(ctx, `
+		UPDATE "Connection"
+		SET "aAction" = CASE WHEN "aAction" IS NULL THEN NULL ELSE 'DISLIKED' END,
+		    "aActedAt" = CASE WHEN "aAction" IS NULL THEN NULL ELSE NOW() END,
+		    "bAction" = CASE WHEN "bAction" IS NULL THEN NULL ELSE 'DISLIKED' END,
+		    "bActedAt" = CASE WHEN "bAction" IS NULL THEN NULL ELSE NOW() END,
+		    "unmatchedAt" = CASE WHEN "matchedAt" IS NULL THEN "unmatchedAt" ELSE NOW() END,
+		    "matchedAt" = NULL,
+		    "updatedAt" = NOW()
+		WHERE "id" = $1
+	`, p.id)
+	if err != nil {
+		return res, err
+	}
+	event := connEventDisconnected
+	if p.matched {
+		event = connEventUnmatched
+		res.unmatched = true
+		res.chatIDs, err = closeChatsBetween(ctx, s.q, userID, targetID)
+		if err != nil {
+			return res, err
+		}
+	}
+	if err := s.logTransition(ctx, userID, targetID, event, p.status(), connDisliked); err != nil {
+		return res, err
+	}
+
+	for _, action := range []string{p.mine, p.theirs} {
+		if action != "" {
+			res.changed++
+		}
+	}
+	return res, nil
+}
+
+// Undo стирает свой LIKED/DISLIKED к targetID (rewind); возвращает стёртое действие.
+// Матч и суперлайк так не отменить.
+func (s connectionService) Undo(ctx context.Context, userID, targetID int64) (string, error) {
+	if err := lockConnectionPair(ctx, s.q, userID, targetID); err != nil {
+		return "", err
+	}
+	p, err := s.loadPair(ctx, userID, targetID)
+	if err != nil {
+		return "", err
+	}
+	if p.mine == "" {
+		return "", errConnectionNotFound
+	}
+	if p.matched || (p.mine != connLiked && p.mine != connDisliked) {
+		return "", &connTransitionError{From: p.status(), To: "NONE"}
+	}
+
+	undone := p.mine
+	if err := s.logTransition(ctx, userID, targetID, connEventUndone, undone, ""); err != nil {
+		return "", err
+	}
+	if p.theirs == "" {
+		// от пары ничего не осталось
+		if _, err := s.q.Exec(ctx, `DELETE FROM "Connection" WHERE "id" = $1`, p.id); err != nil {
+			return "", err
+		}
+		return undone, nil
+	}
+	if err := s.setAction(ctx, &p, userID, targetID, ""); err != nil {
+		return "", err
+	}
+	return undone, nil
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+)
+
+func TestConnTransitionsMatchedOnlyViaDisconnect(t *testing.T) {
+	for _, to := range []string{connLiked, connSuperLiked, connDisliked} {
+		err := checkConnTransition(connMatched, to)
+		if !errors.Is(err, errInvalidTransition) {
+			t.Errorf("MATCHED -> %s: got %v, want invalid transition", to, err)
+		}
+	}
+}
+
+func swipeInTx(ctx context.Context, userID, targetID int64, status string) (connectionActionResult, error) {
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return connectionActionResult{}, err
+	}
+	defer tx.Rollback(ctx)
+
+	res, err := connectionsIn(tx).Swipe(ctx, userID, targetID, status)
+	if err != nil {
+		return res, err
+	}
+	return res, tx.Commit(ctx)
+}
+
+// два встречных лайка одновременно: лок пары должен дать ровно один матч
+func TestSwipeMutualLikeRace(t *testing.T) {
+	ctx := setupTestDB(t)
+
+	for i := 0; i < 20; i++ {
+		a, b := createTestUser(t, ctx), createTestUser(t, ctx)
+
+		var wg sync.WaitGroup
+		start := make(chan struct{})
+		results := make([]connectionActionResult, 2)
+		errs := make([]error, 2)
+		for k, p := range [][2]int64{{a, b}, {b, a}} {
+			wg.Add(1)
+			go func(k int, from, to int64) {
+				defer wg.Done()
+				<-start
+				results[k], errs[k] = swipeInTx(ctx, from, to, connLiked)
+			}(k, p[0], p[1])
+		}
+		close(start)
+		wg.Wait()
+
+		for k, err := range errs {
+			if err != nil {
+				t.Fatalf("round %d: swipe %d: %v", i, k, err)
+			}
+		}
+		if results[0].Matched == results[1].Matched {
+			t.Fatalf("round %d: want exactly one swipe to report a match, got %v and %v",
+				i, results[0].Matched, results[1].Matched)
+		}
+
+		var rowsN, matchedN int
+		err := db.QueryRow(ctx, `
+			SELECT COUNT(*), COUNT(*) FILTER (WHERE "matchedAt" IS NOT NULL)
+			FROM "Connection"
+			WHERE "userAId" = LEAST($1::bigint, $2::bigint) AND "userBId" = GREATEST($1::bigint, $2::bigint)
+		`, a, b).Scan(&rowsN, &matchedN)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rowsN != 1 || matchedN != 1 {
+			t.Fatalf("round %d: want one matched pair row, got %d rows, %d with matchedAt", i, rowsN, matchedN)
+		}
+
+		var transitionsN int
+		err = db.QueryRow(ctx, `
+			SELECT COUNT(*)
+			FROM "ConnectionTransition"
+			WHERE "userAId" = LEAST($1::bigint, $2::bigint) AND "userBId" = GREATEST($1::bigint, $2::bigint)
+			  AND "event" = $3
+		`, a, b, connEventMatched).Scan(&transitionsN)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if transitionsN != 1 {
+			t.Fatalf("round %d: want exactly one MATCHED transition, got %d", i, transitionsN)
+		}
+	}
+}
+
+func TestSwipeDislikeOnMatchConflicts(t *testing.T) {
+	ctx := setupTestDB(t)
+	a, b := createTestUser(t, ctx), createTestUser(t, ctx)
+
+	if _, err := swipeInTx(ctx, a, b, connLiked); err != nil {
+		t.Fatal(err)
+	}
+	res, err := swipeInTx(ctx, b, a, connLiked)
+	if err != nil || !res.Matched {
+		t.Fatalf("want match, got %+v, %v", res, err)
+	}
+
+	_, err = swipeInTx(ctx, a, b, connDisliked)
+	if !errors.Is(err, errInvalidTransition) {
+		t.Fatalf("dislike on a match: got %v, want invalid transition", err)
+	}
+
+	var matched bool
+	err = db.QueryRow(ctx, `
+		SELECT "matchedAt" IS NOT NULL
+		FROM "Connection"
+		WHERE "userAId" = LEAST($1::bigint, $2::bigint) AND "userBId" = GREATEST($1::bigint, $2::bigint)
+	`, a, b).Scan(&matched)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !matched {
+		t.Fatal("pair is no longer matched after a rejected dislike")
+	}
+}
@@ -7,9 +7,18 @@ CREATE TABLE IF NOT EXISTS "User" (
   "dateOfBirth"  DATE        NOT NULL,
   "sex"          TEXT        NOT NULL,      -- MALE / FEMALE / OTHER
   "createdAt"    TIMESTAMPTZ NOT NULL DEFAULT NOW(),
-  "updatedAt"    TIMESTAMPTZ NOT NULL DEFAULT NOW()
+  "updatedAt"    TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  "profileChangedAt" TIMESTAMPTZ,  -- last significant profile change (new photo, rewritten bio, move)
+  "role"           TEXT        NOT NULL DEFAULT 'USER',  -- USER / MODERATOR
+  "suspendedUntil" TIMESTAMPTZ,
+  "bannedAt"       TIMESTAMPTZ
 );
 
+ALTER TABLE "User" ADD COLUMN IF NOT EXISTS "profileChangedAt" TIMESTAMPTZ;
+ALTER TABLE "User" ADD COLUMN IF NOT EXISTS "role" TEXT NOT NULL DEFAULT 'USER';
+ALTER TABLE "User" ADD COLUMN IF NOT EXISTS "suspendedUntil" TIMESTAMPTZ;
+ALTER TABLE "User" ADD COLUMN IF NOT EXISTS "bannedAt" TIMESTAMPTZ;
+
 -- PHOTOS
 CREATE TABLE IF NOT EXISTS "Photo" (
   "id"     BIGSERIAL PRIMARY KEY,
@@ -34,9 +43,14 @@ CREATE TABLE IF NOT EXISTS "Profile" (
   "location"   TEXT,
   "latitude"   DOUBLE PRECISION,
   "longitude"  DOUBLE PRECISION,
-  "superLikes" INT      NOT NULL DEFAULT 0
+  "superLikes" INT      NOT NULL DEFAULT 0,
+  "superLikesRefilledAt" TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  "timezone"   TEXT     NOT NULL DEFAULT 'UTC'  -- IANA name, daily limits reset at local midnight
 );
 
+ALTER TABLE "Profile" ADD COLUMN IF NOT EXISTS "superLikesRefilledAt" TIMESTAMPTZ NOT NULL DEFAULT NOW();
+ALTER TABLE "Profile" ADD COLUMN IF NOT EXISTS "timezone" TEXT NOT NULL DEFAULT 'UTC';
+
 -- PREFERENCES
 CREATE TABLE IF NOT EXISTS "Preferences" (
   "id"            BIGSERIAL PRIMARY KEY,
@@ -44,20 +58,213 @@ CREATE TABLE IF NOT EXISTS "Preferences" (
   "preferredSex"  TEXT   NOT NULL DEFAULT 'ALL', -- MALE/FEMALE/OTHER/ALL
   "ageMin"        INT,
   "ageMax"        INT,
-  "maxDistanceKm" INT
+  "maxDistanceKm" INT,
+  "resurfacePassed" BOOLEAN NOT NULL DEFAULT TRUE  -- show passed profiles again after they change
 );
 
+ALTER TABLE "Preferences" ADD COLUMN IF NOT EXISTS "resurfacePassed" BOOLEAN NOT NULL DEFAULT TRUE;
+
 -- CONNECTIONS (likes, matches, etc.)
+-- Одна строка на неупорядоченную пару: "userAId" < "userBId", у каждой
+-- стороны своё действие. Матч — "matchedAt" IS NOT NULL.
+
+-- старая схема (строка на направление) -> переименовываем, данные переносим ниже
+DO $$
+BEGIN
+  IF EXISTS (
+    SELECT 1 FROM information_schema.columns
+    WHERE table_schema = current_schema()
+      AND table_name = 'Connection'
+      AND column_name = 'fromUserId'
+  ) THEN
+    ALTER TABLE "Connection" RENAME TO "ConnectionLegacy";
+    ALTER INDEX IF EXISTS "Connection_pkey" RENAME TO "ConnectionLegacy_pkey";
+    ALTER INDEX IF EXISTS "Connection_from_updated" RENAME TO "ConnectionLegacy_from_updated";
+    ALTER INDEX IF EXISTS "Connection_from_to_unique" RENAME TO "ConnectionLegacy_from_to_unique";
+    ALTER SEQUENCE IF EXISTS "Connection_id_seq" RENAME TO "ConnectionLegacy_id_seq";
+  END IF;
+END $$;
+
 CREATE TABLE IF NOT EXISTS "Connection" (
+  "id"        BIGSERIAL PRIMARY KEY,
+  "userAId"   BIGINT      NOT NULL REFERENCES "User"("id") ON DELETE CASCADE,  -- меньший id пары
+  "userBId"   BIGINT      NOT NULL REFERENCES "User"("id") ON DELETE CASCADE,  -- больший id пары
+  "aAction"   TEXT,                   -- LIKED / SUPERLIKED / DISLIKED / PENDING, NULL — ещё не свайпал
+  "aActedAt"  TIMESTAMPTZ,
+  "bAction"   TEXT,
+  "bActedAt"  TIMESTAMPTZ,
+  "matchedAt" TIMESTAMPTZ,            -- NOT NULL, пока пара в матче
+  "createdAt" TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  "updatedAt" TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  CHECK ("userAId" < "userBId")
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS "Connection_pair_unique"
+  ON "Connection" ("userAId","userBId");
+
+CREATE INDEX IF NOT EXISTS "Connection_userB"
+  ON "Connection" ("userBId");
+
+-- когда матч разорван (анматч); пока пара не сматчится снова, друг для друга они offline
+ALTER TABLE "Connection" ADD COLUMN IF NOT EXISTS "unmatchedAt" TIMESTAMPTZ;
+
+-- перенос из строк на направление: MATCHED в любой из строк — матч,
+-- иначе каждая строка становится действием своей стороны
+DO $$
+BEGIN
+  IF to_regclass('"ConnectionLegacy"') IS NOT NULL THEN
+    -- в исходной схеме у строк был только "createdAt"
+    ALTER TABLE "ConnectionLegacy" ADD COLUMN IF NOT EXISTS "updatedAt" TIMESTAMPTZ;
+    UPDATE "ConnectionLegacy" SET "updatedAt" = "createdAt" WHERE "updatedAt" IS NULL;
+
+    INSERT INTO "Connection" ("userAId","userBId","aAction","aActedAt","bAction","bActedAt",
+                              "matchedAt","createdAt","updatedAt")
+    SELECT p."a", p."b",
+           CASE WHEN p."matchedAt" IS NOT NULL THEN 'LIKED' ELSE ab."status" END,
+           CASE WHEN p."matchedAt" IS NOT NULL THEN COALESCE(ab."createdAt", p."matchedAt") ELSE ab."updatedAt" END,
+           CASE WHEN p."matchedAt" IS NOT NULL THEN 'LIKED' ELSE ba."status" END,
+           CASE WHEN p."matchedAt" IS NOT NULL THEN COALESCE(ba."createdAt", p."matchedAt") ELSE ba."updatedAt" END,
+           p."matchedAt", p."createdAt", p."updatedAt"
+    FROM (
+      SELECT LEAST("fromUserId","toUserId") AS "a",
+             GREATEST("fromUserId","toUserId") AS "b",
+             MAX("updatedAt") FILTER (WHERE "status" = 'MATCHED') AS "matchedAt",
+             MIN("createdAt") AS "createdAt",
+             MAX("updatedAt") AS "updatedAt"
+      FROM "ConnectionLegacy"
+      WHERE "fromUserId" <> "toUserId"
+      GROUP BY 1, 2
+    ) p
+    LEFT JOIN "ConnectionLegacy" ab ON ab."fromUserId" = p."a" AND ab."toUserId" = p."b"
+    LEFT JOIN "ConnectionLegacy" ba ON ba."fromUserId" = p."b" AND ba."toUserId" = p."a"
+    ON CONFLICT ("userAId","userBId") DO NOTHING;
+
+    DROP TABLE "ConnectionLegacy";
+  END IF;
+END $$;
+
+-- журнал переходов: каждое действие над парой, статус направления actor -> другой до и после
+CREATE TABLE IF NOT EXISTS "ConnectionTransition" (
   "id"         BIGSERIAL PRIMARY KEY,
-  "fromUserId" BIGINT      NOT NULL REFERENCES "User"("id") ON DELETE CASCADE,
-  "toUserId"   BIGINT      NOT NULL REFERENCES "User"("id") ON DELETE CASCADE,
-  "status"     TEXT        NOT NULL,          -- LIKED / SUPERLIKED / DISLIKED / MATCHED / PENDING
+  "userAId"    BIGINT      NOT NULL REFERENCES "User"("id") ON DELETE CASCADE,
+  "userBId"    BIGINT      NOT NULL REFERENCES "User"("id") ON DELETE CASCADE,
+  "actorId"    BIGINT      NOT NULL REFERENCES "User"("id") ON DELETE CASCADE,
+  "event"      TEXT        NOT NULL,  -- LIKED / SUPERLIKED / DISLIKED / MATCHED / REJECTED / UNMATCHED / DISCONNECTED / UNDONE
+  "fromStatus" TEXT,
+  "toStatus"   TEXT,
   "createdAt"  TIMESTAMPTZ NOT NULL DEFAULT NOW()
 );
 
-CREATE UNIQUE INDEX IF NOT EXISTS "Connection_from_to_unique"
-  ON "Connection" ("fromUserId","toUserId");
+CREATE INDEX IF NOT EXISTS "ConnectionTransition_userA"
+  ON "ConnectionTransition" ("userAId","id" DESC);
+
+CREATE INDEX IF NOT EXISTS "ConnectionTransition_userB"
+  ON "ConnectionTransition" ("userBId","id" DESC);
+
+-- пары, созданные до журнала: восстанавливаем последние действия и матч
+DO $$
+BEGIN
+  IF NOT EXISTS (SELECT 1 FROM "ConnectionTransition") THEN
+    INSERT INTO "ConnectionTransition" ("userAId","userBId","actorId","event","toStatus","createdAt")
+    SELECT e."userAId", e."userBId", e."actorId", e."event", e."event", COALESCE(e."at", NOW())
+    FROM (
+      SELECT "userAId", "userBId", "userAId" AS "actorId", "aAction" AS "event", "aActedAt" AS "at"
+      FROM "Connection" WHERE "aAction" IS NOT NULL
+      UNION ALL
+      SELECT "userAId", "userBId", "userBId", "bAction", "bActedAt"
+      FROM "Connection" WHERE "bAction" IS NOT NULL
+      UNION ALL
+      SELECT "userAId", "userBId",
+             CASE WHEN "aActedAt" > "bActedAt" THEN "userAId" ELSE "userBId" END,
+             'MATCHED', "matchedAt"
+      FROM "Connection" WHERE "matchedAt" IS NOT NULL
+    ) e
+    ORDER BY e."at", e."event" = 'MATCHED';
+  END IF;
+END $$;
+
+-- пара глазами каждого из двух юзеров: "action" — моё, "otherAction" — его
+CREATE OR REPLACE VIEW "ConnectionSide" AS
+  SELECT "id", "userAId" AS "userId", "userBId" AS "otherUserId",
+         "aAction" AS "action", "aActedAt" AS "actedAt",
+         "bAction" AS "otherAction", "bActedAt" AS "otherActedAt",
+         "matchedAt", "createdAt", "updatedAt"
+  FROM "Connection"
+  UNION ALL
+  SELECT "id", "userBId", "userAId",
+         "bAction", "bActedAt",
+         "aAction", "aActedAt",
+         "matchedAt", "createdAt", "updatedAt"
+  FROM "Connection";
+
+-- ПЛАТНЫЕ ФИЧИ: права, выданные юзеру напрямую (промо, поддержка)
+CREATE TABLE IF NOT EXISTS "UserEntitlement" (
+  "userId"    BIGINT      NOT NULL REFERENCES "User"("id") ON DELETE CASCADE,
+  "feature"   TEXT        NOT NULL,          -- likes_you, ...
+  "expiresAt" TIMESTAMPTZ,                   -- NULL — бессрочно
+  "createdAt" TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  PRIMARY KEY ("userId","feature")
+);
+
+-- тарифы подписки
+CREATE TABLE IF NOT EXISTS "Plan" (
+  "id"         TEXT    PRIMARY KEY,             -- plus, gold
+  "name"       TEXT    NOT NULL,
+  "features"   TEXT[]  NOT NULL DEFAULT '{}',
+  "priceCents" INT     NOT NULL,
+  "currency"   TEXT    NOT NULL DEFAULT 'EUR',
+  "periodDays" INT     NOT NULL DEFAULT 30,
+  "active"     BOOLEAN NOT NULL DEFAULT TRUE    -- можно ли купить сейчас
+);
+
+INSERT INTO "Plan" ("id","name","features","priceCents","currency","periodDays") VALUES
+  ('plus', 'Plus', ARRAY['likes_you','unlimited_likes','extra_rewinds'], 999, 'EUR', 30),
+  ('gold', 'Gold', ARRAY['likes_you','unlimited_likes','extra_rewinds','extra_superlikes','extra_boosts'], 1999, 'EUR', 30)
+ON CONFLICT ("id") DO NOTHING;
+
+-- подписки; источник правды — события провайдера ("PaymentEvent")
+CREATE TABLE IF NOT EXISTS "Subscription" (
+  "id"                     BIGSERIAL PRIMARY KEY,
+  "userId"                 BIGINT      NOT NULL REFERENCES "User"("id") ON DELETE CASCADE,
+  "planId"                 TEXT        NOT NULL REFERENCES "Plan"("id"),
+  "status"                 TEXT        NOT NULL,   -- ACTIVE / CANCELED (действует до конца периода) / EXPIRED
+  "provider"               TEXT        NOT NULL,
+  "providerSubscriptionId" TEXT        NOT NULL,
+  "currentPeriodStart"     TIMESTAMPTZ NOT NULL,
+  "currentPeriodEnd"       TIMESTAMPTZ NOT NULL,
+  "canceledAt"             TIMESTAMPTZ,
+  "createdAt"              TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  "updatedAt"              TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS "Subscription_provider_unique"
+  ON "Subscription" ("provider","providerSubscriptionId");
+
+CREATE INDEX IF NOT EXISTS "Subscription_user"
+  ON "Subscription" ("userId","currentPeriodEnd" DESC);
+
+-- обработанные вебхуки провайдера (идемпотентность)
+CREATE TABLE IF NOT EXISTS "PaymentEvent" (
+  "provider"   TEXT        NOT NULL,
+  "eventId"    TEXT        NOT NULL,
+  "type"       TEXT        NOT NULL,
+  "payload"    JSONB       NOT NULL,
+  "receivedAt" TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  PRIMARY KEY ("provider","eventId")
+);
+
+-- все действующие права юзера: ручные + из оплаченного периода подписки
+CREATE OR REPLACE VIEW "ActiveEntitlement" AS
+  SELECT "userId", "feature", "expiresAt"
+  FROM "UserEntitlement"
+  WHERE "expiresAt" IS NULL OR "expiresAt" > NOW()
+  UNION ALL
+  SELECT s."userId", f."feature", s."currentPeriodEnd"
+  FROM "Subscription" s
+  JOIN "Plan" pl ON pl."id" = s."planId"
+  CROSS JOIN LATERAL unnest(pl."features") AS f("feature")
+  WHERE s."status" <> 'EXPIRED'
+    AND s."currentPeriodEnd" > NOW();
 
 -- CHATS
 CREATE TABLE IF NOT EXISTS "Chat" (
@@ -75,6 +282,20 @@ CREATE TABLE IF NOT EXISTS "ChatUser" (
 CREATE UNIQUE INDEX IF NOT EXISTS "ChatUser_chat_user_unique"
   ON "ChatUser" ("chatId","userId");
 
+-- анматч: чат только для чтения, у того, кто разорвал матч, он скрыт из /chats
+ALTER TABLE "Chat" ADD COLUMN IF NOT EXISTS "closedAt" TIMESTAMPTZ;
+ALTER TABLE "ChatUser" ADD COLUMN IF NOT EXISTS "hiddenAt" TIMESTAMPTZ;
+
+-- групповые чаты: DIRECT — 1-1 (матч, запрос, поддержка), GROUP — с названием и ролями
+ALTER TABLE "Chat" ADD COLUMN IF NOT EXISTS "kind" TEXT NOT NULL DEFAULT 'DIRECT';  -- DIRECT / GROUP
+ALTER TABLE "Chat" ADD COLUMN IF NOT EXISTS "title" TEXT;
+ALTER TABLE "Chat" ADD COLUMN IF NOT EXISTS "createdById" BIGINT REFERENCES "User"("id") ON DELETE SET NULL;
+ALTER TABLE "ChatUser" ADD COLUMN IF NOT EXISTS "role" TEXT NOT NULL DEFAULT 'MEMBER';  -- OWNER / ADMIN / MEMBER
+ALTER TABLE "ChatUser" ADD COLUMN IF NOT EXISTS "joinedAt" TIMESTAMPTZ NOT NULL DEFAULT NOW();
+
+CREATE INDEX IF NOT EXISTS "ChatUser_user"
+  ON "ChatUser" ("userId");
+
 -- MESSAGES
 CREATE TABLE IF NOT EXISTS "Message" (
   "id"        BIGSERIAL PRIMARY KEY,
@@ -84,6 +305,13 @@ CREATE TABLE IF NOT EXISTS "Message" (
   "timestamp" TIMESTAMPTZ NOT NULL DEFAULT NOW()
 );
 
+-- id сообщения на клиенте: повторная отправка с тем же id не создаёт дубль
+ALTER TABLE "Message" ADD COLUMN IF NOT EXISTS "clientId" TEXT;
+
+CREATE UNIQUE INDEX IF NOT EXISTS "Message_sender_client_unique"
+  ON "Message" ("senderId","clientId")
+  WHERE "clientId" IS NOT NULL;
+
 -- READ STATE PER CHAT/USER
 CREATE TABLE IF NOT EXISTS "ChatRead" (
   "chatId"    BIGINT      NOT NULL REFERENCES "Chat"("id") ON DELETE CASCADE,
@@ -91,3 +319,186 @@ CREATE TABLE IF NOT EXISTS "ChatRead" (
   "lastReadAt" TIMESTAMPTZ NOT NULL DEFAULT NOW(),
   PRIMARY KEY ("chatId","userId")
 );
+
+-- PRECOMPUTED RECOMMENDATIONS (filled by the background worker)
+CREATE TABLE IF NOT EXISTS "RecommendationQueue" (
+  "userId"      BIGINT           NOT NULL REFERENCES "User"("id") ON DELETE CASCADE,
+  "candidateId" BIGINT           NOT NULL REFERENCES "User"("id") ON DELETE CASCADE,
+  "position"    INT              NOT NULL,
+  "score"       DOUBLE PRECISION NOT NULL,
+  PRIMARY KEY ("userId","candidateId")
+);
+
+CREATE INDEX IF NOT EXISTS "RecommendationQueue_user_position"
+  ON "RecommendationQueue" ("userId","position");
+
+-- чьи очереди пересчитать, когда кандидат поменял анкету
+CREATE INDEX IF NOT EXISTS "RecommendationQueue_candidate"
+  ON "RecommendationQueue" ("candidateId");
+
+CREATE TABLE IF NOT EXISTS "RecommendationQueueState" (
+  "userId"     BIGINT      PRIMARY KEY REFERENCES "User"("id") ON DELETE CASCADE,
+  "stale"      BOOLEAN     NOT NULL DEFAULT TRUE,
+  "computedAt" TIMESTAMPTZ,
+  "staleSince" TIMESTAMPTZ
+);
+
+-- REWINDS (undone swipes, used for the daily limit and to pin the candidate back)
+CREATE TABLE IF NOT EXISTS "Rewind" (
+  "id"           BIGSERIAL PRIMARY KEY,
+  "userId"       BIGINT      NOT NULL REFERENCES "User"("id") ON DELETE CASCADE,
+  "targetUserId" BIGINT      NOT NULL REFERENCES "User"("id") ON DELETE CASCADE,
+  "status"       TEXT        NOT NULL,          -- status that was undone
+  "createdAt"    TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS "Rewind_user_created"
+  ON "Rewind" ("userId","createdAt" DESC);
+
+-- LIKES PER USER PER LOCAL DAY (daily like limit)
+CREATE TABLE IF NOT EXISTS "DailyLikeCount" (
+  "userId" BIGINT NOT NULL REFERENCES "User"("id") ON DELETE CASCADE,
+  "day"    DATE   NOT NULL,
+  "likes"  INT    NOT NULL DEFAULT 0,
+  PRIMARY KEY ("userId","day")
+);
+
+-- конец суток, зафиксированный первым лайком (смена часового пояса его не двигает)
+ALTER TABLE "DailyLikeCount" ADD COLUMN IF NOT EXISTS "resetsAt" TIMESTAMPTZ;
+UPDATE "DailyLikeCount" SET "resetsAt" = ("day" + 1)::timestamptz WHERE "resetsAt" IS NULL;
+ALTER TABLE "DailyLikeCount" ALTER COLUMN "resetsAt" SET NOT NULL;
+
+-- PROFILE BOOSTS (temporary ranking promotion)
+CREATE TABLE IF NOT EXISTS "Boost" (
+  "id"          BIGSERIAL PRIMARY KEY,
+  "userId"      BIGINT      NOT NULL REFERENCES "User"("id") ON DELETE CASCADE,
+  "startsAt"    TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  "endsAt"      TIMESTAMPTZ NOT NULL,
+  "impressions" INT         NOT NULL DEFAULT 0
+);
+
+CREATE INDEX IF NOT EXISTS "Boost_user_starts"
+  ON "Boost" ("userId","startsAt" DESC);
+
+CREATE INDEX IF NOT EXISTS "Boost_ends"
+  ON "Boost" ("endsAt");
+
+-- RECOMMENDATION EVENT LOG (append-only: impressions, swipes, matches)
+-- no foreign keys on purpose: the log outlives deleted users
+CREATE TABLE IF NOT EXISTS "RecommendationEvent" (
+  "id"          BIGSERIAL PRIMARY KEY,
+  "userId"      BIGINT           NOT NULL,  -- who saw / who swiped
+  "candidateId" BIGINT           NOT NULL,  -- who was shown / swiped on
+  "type"        TEXT             NOT NULL,  -- IMPRESSION / LIKE / SUPERLIKE / DISLIKE / MATCH
+  "score"       DOUBLE PRECISION,
+  "components"  JSONB,
+  "source"      TEXT,                       -- queue / live for impressions
+  "position"    INT,
+  "experiment"  TEXT,                       -- A/B experiment and variant of "userId"
+  "variant"     TEXT,
+  "createdAt"   TIMESTAMPTZ      NOT NULL DEFAULT NOW()
+);
+
+ALTER TABLE "RecommendationEvent" ADD COLUMN IF NOT EXISTS "experiment" TEXT;
+ALTER TABLE "RecommendationEvent" ADD COLUMN IF NOT EXISTS "variant" TEXT;
+
+CREATE INDEX IF NOT EXISTS "RecommendationEvent_experiment"
+  ON "RecommendationEvent" ("experiment","variant","type");
+
+CREATE INDEX IF NOT EXISTS "RecommendationEvent_type_created"
+  ON "RecommendationEvent" ("type","createdAt");
+
+CREATE INDEX IF NOT EXISTS "RecommendationEvent_user_candidate"
+  ON "RecommendationEvent" ("userId","candidateId");
+
+-- COLLABORATIVE FILTERING SCORES (written by cmd/affinity, 0..1 per user)
+CREATE TABLE IF NOT EXISTS "CandidateAffinity" (
+  "userId"      BIGINT           NOT NULL REFERENCES "User"("id") ON DELETE CASCADE,
+  "candidateId" BIGINT           NOT NULL REFERENCES "User"("id") ON DELETE CASCADE,
+  "score"       DOUBLE PRECISION NOT NULL,
+  "computedAt"  TIMESTAMPTZ      NOT NULL DEFAULT NOW(),
+  PRIMARY KEY ("userId","candidateId")
+);
+
+-- BIO TERM FREQUENCIES (aboutMe + goals, tokenized without stop words)
+-- IDF and TF-IDF vectors are computed in the API process from this table
+CREATE TABLE IF NOT EXISTS "BioTerms" (
+  "userId"    BIGINT      PRIMARY KEY REFERENCES "User"("id") ON DELETE CASCADE,
+  "terms"     JSONB       NOT NULL DEFAULT '{}',  -- {"term": count}
+  "updatedAt" TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- INTERNAL ELO-STYLE RATING (updated from incoming likes/dislikes, never exposed)
+CREATE TABLE IF NOT EXISTS "UserRating" (
+  "userId"    BIGINT           PRIMARY KEY REFERENCES "User"("id") ON DELETE CASCADE,
+  "rating"    DOUBLE PRECISION NOT NULL DEFAULT 1000,
+  "votes"     INT              NOT NULL DEFAULT 0,
+  "updatedAt" TIMESTAMPTZ      NOT NULL DEFAULT NOW()
+);
+
+-- LAST RATING VOTE PER PAIR (so a rewind can take it back)
+CREATE TABLE IF NOT EXISTS "RatingVote" (
+  "raterId"   BIGINT           NOT NULL REFERENCES "User"("id") ON DELETE CASCADE,
+  "targetId"  BIGINT           NOT NULL REFERENCES "User"("id") ON DELETE CASCADE,
+  "delta"     DOUBLE PRECISION NOT NULL,
+  "createdAt" TIMESTAMPTZ      NOT NULL DEFAULT NOW(),
+  PRIMARY KEY ("raterId","targetId")
+);
+
+-- IMPRESSIONS PER CANDIDATE PER UTC DAY (exposure cap)
+CREATE TABLE IF NOT EXISTS "ExposureCount" (
+  "userId"      BIGINT NOT NULL REFERENCES "User"("id") ON DELETE CASCADE,
+  "day"         DATE   NOT NULL,
+  "impressions" INT    NOT NULL DEFAULT 0,
+  PRIMARY KEY ("userId","day")
+);
+
+-- BLOCKS (hide both users from each other everywhere)
+CREATE TABLE IF NOT EXISTS "Block" (
+  "blockerId" BIGINT      NOT NULL REFERENCES "User"("id") ON DELETE CASCADE,
+  "blockedId" BIGINT      NOT NULL REFERENCES "User"("id") ON DELETE CASCADE,
+  "createdAt" TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  PRIMARY KEY ("blockerId","blockedId")
+);
+
+CREATE INDEX IF NOT EXISTS "Block_blocked"
+  ON "Block" ("blockedId");
+
+-- USER / MESSAGE REPORTS (evidence is a snapshot taken at report time)
+CREATE TABLE IF NOT EXISTS "Report" (
+  "id"             BIGSERIAL PRIMARY KEY,
+  "reporterId"     BIGINT      NOT NULL REFERENCES "User"("id") ON DELETE CASCADE,
+  "reportedUserId" BIGINT      NOT NULL REFERENCES "User"("id") ON DELETE CASCADE,
+  "chatId"         BIGINT,               -- set for message reports; no FK, evidence outlives the chat
+  "messageId"      BIGINT,
+  "reason"         TEXT        NOT NULL, -- SPAM / HARASSMENT / INAPPROPRIATE_CONTENT / FAKE_PROFILE / SCAM / UNDERAGE / OTHER
+  "details"        TEXT,
+  "evidence"       JSONB       NOT NULL,
+  "status"         TEXT        NOT NULL DEFAULT 'OPEN', -- OPEN / ESCALATED / RESOLVED / DISMISSED
+  "createdAt"      TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  "resolvedAt"     TIMESTAMPTZ,
+  "resolvedBy"     BIGINT      REFERENCES "User"("id") ON DELETE SET NULL,
+  "resolution"     TEXT
+);
+
+CREATE INDEX IF NOT EXISTS "Report_status_created"
+  ON "Report" ("status","createdAt");
+
+CREATE INDEX IF NOT EXISTS "Report_reported"
+  ON "Report" ("reportedUserId");
+
+-- MODERATOR ACTIONS (audit trail)
+CREATE TABLE IF NOT EXISTS "ModerationAction" (
+  "id"          BIGSERIAL PRIMARY KEY,
+  "reportId"    BIGINT      REFERENCES "Report"("id") ON DELETE SET NULL,
+  "moderatorId" BIGINT      NOT NULL REFERENCES "User"("id"),
+  "userId"      BIGINT      NOT NULL REFERENCES "User"("id") ON DELETE CASCADE,
+  "action"      TEXT        NOT NULL, -- WARN / SUSPEND / BAN / REMOVE_PHOTO
+  "photoId"     BIGINT,
+  "until"       TIMESTAMPTZ,          -- end of a suspension
+  "note"        TEXT,
+  "createdAt"   TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS "ModerationAction_user"
+  ON "ModerationAction" ("userId","createdAt" DESC);
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"log"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// ===== права на платные фичи =====
+//
+// Хендлеры спрашивают только HasEntitlement(ctx, userID, feature) (или
+// limitsFor для квот) и не знают, откуда право взялось. Источники:
+// FREE_FEATURES (открыто всем) и view "ActiveEntitlement" — действующие
+// подписки по тарифам из "Plan" плюс права, выданные вручную в "UserEntitlement".
+
+const (
+	featureLikesYou        = "likes_you"        // кто меня лайкнул
+	featureUnlimitedLikes  = "unlimited_likes"  // без дневного лимита лайков
+	featureExtraSuperLikes = "extra_superlikes" // больше суперлайков при доливке
+	featureExtraRewinds    = "extra_rewinds"    // больше rewind в день
+	featureExtraBoosts     = "extra_boosts"     // больше бустов в неделю
+)
+
+// entitlementSource — один источник прав
+type entitlementSource interface {
+	Features(ctx context.Context, userID int64) ([]string, error)
+}
+
+// freeFeatures — фичи, открытые всем
+type freeFeatures []string
+
+func (f freeFeatures) Features(context.Context, int64) ([]string, error) {
+	return f, nil
+}
+
+// storedFeatures — подписки и выданные права из базы
+type storedFeatures struct{}
+
+func (storedFeatures) Features(ctx context.Context, userID int64) ([]string, error) {
+	rows, err := db.Query(ctx, `
+		SELECT DISTINCT "feature" FROM "ActiveEntitlement" WHERE "userId" = $1
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, pgx.RowTo[string])
+}
+
+var (
+	entitlementSources []entitlementSource
+	freeFeatureSet     = map[string]bool{}
+)
+
+func initEntitlements(cfg Config) {
+	freeFeatureSet = map[string]bool{}
+	for _, f := range cfg.FreeFeatures {
+		freeFeatureSet[f] = true
+	}
+	entitlementSources = []entitlementSource{freeFeatures(cfg.FreeFeatures), storedFeatures{}}
+}
+
+// userFeatures — все фичи, доступные юзеру сейчас
+func userFeatures(ctx context.Context, userID int64) (map[string]bool, error) {
+	out := map[string]bool{}
+	for _, src := range entitlementSources {
+		features, err := src.Features(ctx, userID)
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range features {
+			out[f] = true
+		}
+	}
+	return out, nil
+}
+
+// HasEntitlement — есть ли у юзера доступ к платной фиче
+func HasEntitlement(ctx context.Context, userID int64, feature string) (bool, error) {
+	features, err := userFeatures(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+	return features[feature], nil
+}
+
+// quotaLimits — лимиты свайпов и бустов с учётом подписки
+type quotaLimits struct {
+	likesDaily      int // 0 — без лимита
+	superLikeRefill int
+	rewindsDaily    int
+	boostsWeekly    int
+}
+
+// limitsFor — лимиты юзера; если права не прочитались, действуют бесплатные
+func limitsFor(ctx context.Context, userID int64) quotaLimits {
+	limits := quotaLimits{
+		likesDaily:      appConfig.LikesDailyLimit,
+		superLikeRefill: appConfig.SuperLikeRefillAmount,
+		rewindsDaily:    appConfig.RewindDailyLimit,
+		boostsWeekly:    appConfig.BoostWeeklyLimit,
+	}
+	features, err := userFeatures(ctx, userID)
+	if err != nil {
+		log.Printf("entitlements for %d: %v", userID, err)
+		return limits
+	}
+	if features[featureUnlimitedLikes] {
+		limits.likesDaily = 0
+	}
+	if features[featureExtraSuperLikes] {
+		limits.superLikeRefill = max(limits.superLikeRefill, appConfig.PremiumSuperLikeRefillAmount)
+	}
+	if features[featureExtraRewinds] {
+		limits.rewindsDaily = max(limits.rewindsDaily, appConfig.PremiumRewindDailyLimit)
+	}
+	if features[featureExtraBoosts] {
+		limits.boostsWeekly = max(limits.boostsWeekly, appConfig.PremiumBoostWeeklyLimit)
+	}
+	return limits
+}
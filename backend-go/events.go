@@ -0,0 +1,204 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// ===== лог событий рекомендаций =====
+//
+// Показы, лайки, дизлайки и матчи пишутся в "RecommendationEvent" только на
+// добавление. Хендлеры кладут событие в буферизованный канал и сразу отвечают,
+// а runEventLogWriter пишет их пачками через COPY.
+
+type recEvent struct {
+	UserID      int64
+	CandidateID int64
+	Type        string // IMPRESSION / LIKE / SUPERLIKE / DISLIKE / MATCH
+	Score       *float64
+	Components  []scoreComponent
+	Source      string
+	Position    *int
+	Experiment  string
+	Variant     string
+	CreatedAt   time.Time
+}
+
+var (
+	recEvents        chan recEvent
+	recEventsDropped atomic.Int64
+	recEventsColumns = []string{
+		"userId", "candidateId", "type", "score", "components", "source", "position",
+		"experiment", "variant", "createdAt",
+	}
+)
+
+func initEventLog(cfg Config) {
+	recEvents = make(chan recEvent, cfg.EventBufferSize)
+}
+
+// logRecEvent никогда не блокирует: если буфер забит, событие теряется
+func logRecEvent(e recEvent) {
+	if recEvents == nil {
+		return
+	}
+	if e.CreatedAt.IsZero() {
+		e.CreatedAt = time.Now()
+	}
+	// каждое событие помечаем вариантом эксперимента того, кто его совершил
+	if e.Experiment == "" {
+		a := rankingAssignment(e.UserID)
+		e.Experiment, e.Variant = a.Experiment, a.Variant
+	}
+	select {
+	case recEvents <- e:
+	default:
+		if n := recEventsDropped.Add(1); n%1000 == 1 {
+			log.Printf("event log: buffer full, dropped %d events so far", n)
+		}
+	}
+}
+
+// logSwipeEvents пишет свайп и, если он дал матч, матч для обеих сторон
+func logSwipeEvents(userID, targetID int64, status string, matched bool) {
+	switch status {
+	case "LIKED":
+		logRecEvent(recEvent{UserID: userID, CandidateID: targetID, Type: "LIKE"})
+	case "SUPERLIKED":
+		logRecEvent(recEvent{UserID: userID, CandidateID: targetID, Type: "SUPERLIKE"})
+	case "DISLIKED":
+		logRecEvent(recEvent{UserID: userID, CandidateID: targetID, Type: "DISLIKE"})
+	}
+	if matched {
+		logMatchEvents(userID, targetID)
+	}
+}
+
+func logMatchEvents(user1, user2 int64) {
+	now := time.Now()
+	logRecEvent(recEvent{UserID: user1, CandidateID: user2, Type: "MATCH", CreatedAt: now})
+	logRecEvent(recEvent{UserID: user2, CandidateID: user1, Type: "MATCH", CreatedAt: now})
+}
+
+func runEventLogWriter(ctx context.Context, cfg Config) {
+	ticker := time.NewTicker(cfg.EventFlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]recEvent, 0, cfg.EventBatchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		fctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		if err := writeRecEvents(fctx, batch); err != nil {
+			log.Printf("event log: failed to write %d events: %v", len(batch), err)
+		}
+		cancel()
+		batch = batch[:0]
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			// остановка: дописываем всё, что уже лежит в буфере
+			for {
+				select {
+				case e := <-recEvents:
+					batch = append(batch, e)
+					if len(batch) >= cfg.EventBatchSize {
+						flush()
+					}
+				default:
+					flush()
+					return
+				}
+			}
+		case e := <-recEvents:
+			batch = append(batch, e)
+			if len(batch) >= cfg.EventBatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+func writeRecEvents(ctx context.Context, batch []recEvent) error {
+	enrichSwipeScores(ctx, batch)
+
+	rows := make([][]any, 0, len(batch))
+	for _, e := range batch {
+		var components any
+		if e.Components != nil {
+			raw, err := json.Marshal(e.Components)
+			if err != nil {
+				return err
+			}
+			components = raw
+		}
+		rows = append(rows, []any{
+			e.UserID, e.CandidateID, e.Type, e.Score, components, nullIfEmpty(e.Source), e.Position,
+			nullIfEmpty(e.Experiment), nullIfEmpty(e.Variant), e.CreatedAt,
+		})
+	}
+
+	_, err := db.CopyFrom(ctx,
+		pgx.Identifier{"RecommendationEvent"},
+		recEventsColumns,
+		pgx.CopyFromRows(rows),
+	)
+	return err
+}
+
+// enrichSwipeScores досчитывает разбивку скоринга для свайпов уже в воркере,
+// чтобы не тормозить сам лайк
+func enrichSwipeScores(ctx context.Context, batch []recEvent) {
+	byUser := map[int64][]int64{}
+	for _, e := range batch {
+		if e.Components == nil && e.Type != "IMPRESSION" {
+			byUser[e.UserID] = append(byUser[e.UserID], e.CandidateID)
+		}
+	}
+
+	scores := map[[2]int64][]scoreComponent{}
+	for userID, ids := range byUser {
+		byID, err := explainCandidates(ctx, userID, ids)
+		if err != nil {
+			// у юзера может не быть полной анкеты — пишем событие без скоринга
+			continue
+		}
+		for id, components := range byID {
+			scores[[2]int64{userID, id}] = components
+		}
+	}
+
+	for i := range batch {
+		e := &batch[i]
+		if e.Components != nil || e.Type == "IMPRESSION" {
+			continue
+		}
+		components, ok := scores[[2]int64{e.UserID, e.CandidateID}]
+		if !ok {
+			continue
+		}
+		total := 0.0
+		for _, c := range components {
+			total += c.Points
+		}
+		e.Components = components
+		e.Score = &total
+	}
+}
+
+func nullIfEmpty(s string) any {
+	if s == "" {
+		return nil
+	}
+	return s
+}
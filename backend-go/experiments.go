@@ -0,0 +1,141 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"strconv"
+)
+
+// ===== A/B эксперименты со стратегиями ранжирования =====
+//
+// Эксперименты читаются из JSON (EXPERIMENTS_FILE) при старте. Юзер попадает
+// в вариант детерминированно: sha256(salt + ":" + userId) по весам вариантов,
+// так что один и тот же юзер всегда видит одну и ту же стратегию.
+
+type experimentVariant struct {
+	Name   string `json:"name"`
+	Weight int    `json:"weight"`
+	Scorer string `json:"scorer"` // ключ из scorers
+}
+
+type experiment struct {
+	Name     string              `json:"name"`
+	Salt     string              `json:"salt"` // по умолчанию = name
+	Enabled  bool                `json:"enabled"`
+	Variants []experimentVariant `json:"variants"`
+}
+
+// куда попал юзер; пустые поля — экспериментов нет
+type experimentAssignment struct {
+	Experiment string
+	Variant    string
+	Scorer     string
+}
+
+var experiments []experiment
+
+func loadExperiments(path string) error {
+	if path == "" {
+		return nil
+	}
+	raw, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var file struct {
+		Experiments []experiment `json:"experiments"`
+	}
+	if err := json.Unmarshal(raw, &file); err != nil {
+		return fmt.Errorf("parse %s: %w", path, err)
+	}
+
+	for _, exp := range file.Experiments {
+		if err := validateExperiment(exp); err != nil {
+			return fmt.Errorf("experiment %q: %w", exp.Name, err)
+		}
+	}
+	experiments = file.Experiments
+
+	for _, exp := range experiments {
+		if exp.Enabled {
+			log.Printf("Experiment %q enabled with %d variants", exp.Name, len(exp.Variants))
+		}
+	}
+	return nil
+}
+
+func validateExperiment(exp experiment) error {
+	if exp.Name == "" {
+		return errors.New("name is required")
+	}
+	if len(exp.Variants) == 0 {
+		return errors.New("at least one variant is required")
+	}
+	seen := map[string]bool{}
+	for _, v := range exp.Variants {
+		if v.Name == "" || seen[v.Name] {
+			return fmt.Errorf("variant names must be unique and non-empty")
+		}
+		seen[v.Name] = true
+		if v.Weight <= 0 {
+			return fmt.Errorf("variant %q: weight must be positive", v.Name)
+		}
+		if _, ok := scorers[v.Scorer]; !ok {
+			return fmt.Errorf("variant %q: unknown scorer %q", v.Name, v.Scorer)
+		}
+	}
+	return nil
+}
+
+// bucketFor детерминированно выбирает вариант по хешу id юзера
+func bucketFor(exp experiment, userID int64) experimentVariant {
+	salt := exp.Salt
+	if salt == "" {
+		salt = exp.Name
+	}
+	sum := sha256.Sum256([]byte(salt + ":" + strconv.FormatInt(userID, 10)))
+	h := binary.BigEndian.Uint64(sum[:8])
+
+	total := 0
+	for _, v := range exp.Variants {
+		total += v.Weight
+	}
+	point := int(h % uint64(total))
+	for _, v := range exp.Variants {
+		if point < v.Weight {
+			return v
+		}
+		point -= v.Weight
+	}
+	return exp.Variants[len(exp.Variants)-1]
+}
+
+// rankingAssignment — вариант первого включённого эксперимента
+func rankingAssignment(userID int64) experimentAssignment {
+	for _, exp := range experiments {
+		if !exp.Enabled {
+			continue
+		}
+		v := bucketFor(exp, userID)
+		return experimentAssignment{
+			Experiment: exp.Name,
+			Variant:    v.Name,
+			Scorer:     v.Scorer,
+		}
+	}
+	return experimentAssignment{Scorer: defaultScorer}
+}
+
+func scorerForUser(userID int64) scorerWeights {
+	return scorerByName(rankingAssignment(userID).Scorer)
+}
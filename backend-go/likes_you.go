@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// ===== кто меня лайкнул =====
+//
+// Лента неотвеченных входящих лайков. С доступом (featureLikesYou) — полные
+// карточки. Без него — только число лайков и размытые превью без id и имён;
+// суперлайки видны всем. Тот же гейт стоит на /connections/requests,
+// событии like_received и /connections/history. Превью размывает сервер (likes_you_preview.go), а
+// наружу уходит только подписанный токен — ни ссылки на фото, ни id автора.
+
+const likesYouPreviewLimit = 12
+
+type likesYouPreview struct {
+	ThumbnailURL *string   `json:"thumbnailUrl"`
+	Blurred      bool      `json:"blurred"`
+	LikedAt      time.Time `json:"likedAt"`
+}
+
+// сколько неотвеченных входящих лайков и из них суперлайков
+func countIncomingLikes(ctx context.Context, userID int64) (int, int, error) {
+	var total, super int
+	err := db.QueryRow(ctx, `
+		SELECT COUNT(*), COUNT(*) FILTER (WHERE cs."otherAction" = 'SUPERLIKED')
+		FROM "ConnectionSide" cs
+		WHERE cs."userId" = $1
+		  AND cs."otherAction" IN ('LIKED','SUPERLIKED')
+		  AND cs."action" IS NULL
+		  AND cs."matchedAt" IS NULL
+		  AND NOT EXISTS (
+			SELECT 1 FROM "Block" b
+			WHERE (b."blockerId" = $1 AND b."blockedId" = cs."otherUserId")
+			   OR (b."blockerId" = cs."otherUserId" AND b."blockedId" = $1)
+		  )
+	`, userID).Scan(&total, &super)
+	return total, super, err
+}
+
+// размытые превью обычных лайков, свежие первыми
+func loadLikesYouPreviews(ctx context.Context, userID int64) ([]likesYouPreview, error) {
+	rows, err := db.Query(ctx, `
+		SELECT (SELECT p."id" FROM "Photo" p
+		        WHERE p."userId" = cs."otherUserId" AND `+previewablePhotoSQL+`
+		        ORDER BY p."id" LIMIT 1),
+		       cs."otherActedAt"
+		FROM "ConnectionSide" cs
+		WHERE cs."userId" = $1
+		  AND cs."otherAction" = 'LIKED'
+		  AND cs."action" IS NULL
+		  AND cs."matchedAt" IS NULL
+		  AND NOT EXISTS (
+			SELECT 1 FROM "Block" b
+			WHERE (b."blockerId" = $1 AND b."blockedId" = cs."otherUserId")
+			   OR (b."blockerId" = cs."otherUserId" AND b."blockedId" = $1)
+		  )
+		ORDER BY cs."otherActedAt" DESC, cs."id" DESC
+		LIMIT $2
+	`, userID, likesYouPreviewLimit)
+	if err != nil {
+		return nil, err
+	}
+	previews, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (likesYouPreview, error) {
+		var photoID *int64
+		p := likesYouPreview{Blurred: true}
+		err := row.Scan(&photoID, &p.LikedAt)
+		if photoID != nil {
+			u := "/likes/previews/" + signPreviewToken(userID, *photoID, time.Now().Add(previewTokenTTL))
+			p.ThumbnailURL = &u
+		}
+		return p, err
+	})
+	if previews == nil {
+		previews = []likesYouPreview{}
+	}
+	return previews, err
+}
+
+// GET /me/likes?sort=superlikes|recent|name&limit=&cursor=
+func handleGetLikesYou(w http.ResponseWriter, r *http.Request) {
+	userID, ok := getUserIDFromContext(r)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "Authentication required")
+		return
+	}
+
+	page, msg := parsePageParams(r, connectionRequestSorts, "superlikes")
+	if msg != "" {
+		writeError(w, http.StatusBadRequest, msg)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	entitled, err := HasEntitlement(ctx, userID, featureLikesYou)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to check subscription")
+		return
+	}
+
+	total, super, err := countIncomingLikes(ctx, userID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to count likes")
+		return
+	}
+	likes, nextCursor, err := loadIncomingLikes(ctx, userID, page, !entitled)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to load likes")
+		return
+	}
+
+	resp := map[string]interface{}{
+		"locked":         !entitled,
+		"count":          total,
+		"superLikeCount": super,
+		"likes":          likes,
+		"nextCursor":     nextCursor,
+	}
+	if !entitled {
+		previews, err := loadLikesYouPreviews(ctx, userID)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "Failed to load likes")
+			return
+		}
+		resp["previews"] = previews
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
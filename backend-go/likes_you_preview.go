@@ -0,0 +1,187 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/gif"
+	"image/jpeg"
+	_ "image/png"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+)
+
+// ===== размытые превью "кто меня лайкнул" =====
+//
+// Без доступа к likes_you юзер получает ссылку /likes/previews/{token}.
+// Токен подписан и привязан к зрителю, фото и сроку; ни ссылки на исходное
+// фото, ни id автора лайка в нём нет. Картинку сервер отдаёт уже размытой —
+// крупной мозаикой, из которой лицо не восстановить. Ссылка открывается без
+// Authorization (её грузит <img>), поэтому всё держится на подписи.
+
+const (
+	previewTokenTTL = time.Hour
+	previewGrid     = 12  // клеток мозаики по длинной стороне
+	previewSize     = 240 // px по длинной стороне на выходе
+)
+
+var errInvalidPreviewToken = errors.New("invalid preview token")
+
+// превью умеем делать только из загруженных фото (data URL с растром)
+const previewablePhotoSQL = `p."url" ~ '^data:image/(png|jpeg|gif);base64,'`
+
+func previewMAC(payload string) []byte {
+	mac := hmac.New(sha256.New, jwtSecret)
+	mac.Write([]byte("likes-preview:" + payload))
+	return mac.Sum(nil)
+}
+
+func signPreviewToken(viewerID, photoID int64, exp time.Time) string {
+	payload := base64.RawURLEncoding.EncodeToString(
+		[]byte(fmt.Sprintf("%d.%d.%d", viewerID, photoID, exp.Unix())))
+	return payload + "." + base64.RawURLEncoding.EncodeToString(previewMAC(payload))
+}
+
+// parsePreviewToken проверяет подпись и срок, возвращает зрителя и фото
+func parsePreviewToken(token string, now time.Time) (int64, int64, error) {
+	payload, sig, ok := strings.Cut(token, ".")
+	if !ok {
+		return 0, 0, errInvalidPreviewToken
+	}
+	rawSig, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil || !hmac.Equal(rawSig, previewMAC(payload)) {
+		return 0, 0, errInvalidPreviewToken
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return 0, 0, errInvalidPreviewToken
+	}
+	parts := strings.Split(string(raw), ".")
+	if len(parts) != 3 {
+		return 0, 0, errInvalidPreviewToken
+	}
+	var nums [3]int64
+	for i, part := range parts {
+		if nums[i], err = strconv.ParseInt(part, 10, 64); err != nil {
+			return 0, 0, errInvalidPreviewToken
+		}
+	}
+	if now.Unix() >= nums[2] {
+		return 0, 0, errInvalidPreviewToken
+	}
+	return nums[0], nums[1], nil
+}
+
+// decodeDataURLImage разбирает data:image/...;base64,...
+func decodeDataURLImage(dataURL string) (image.Image, error) {
+	_, encoded, ok := strings.Cut(dataURL, ";base64,")
+	if !ok {
+		return nil, errors.New("not a base64 data url")
+	}
+	raw, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, err
+	}
+	img, _, err := image.Decode(bytes.NewReader(raw))
+	return img, err
+}
+
+// pixelate усредняет картинку в сетку previewGrid клеток по длинной стороне
+// и растягивает её до previewSize
+func pixelate(src image.Image) image.Image {
+	b := src.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w == 0 || h == 0 {
+		return image.NewRGBA(image.Rect(0, 0, 1, 1))
+	}
+	long := max(w, h)
+	gw, gh := max(w*previewGrid/long, 1), max(h*previewGrid/long, 1)
+	ow, oh := max(w*previewSize/long, gw), max(h*previewSize/long, gh)
+
+	// средний цвет каждой клетки
+	cells := make([]color.RGBA, gw*gh)
+	for cy := 0; cy < gh; cy++ {
+		for cx := 0; cx < gw; cx++ {
+			x0, x1 := b.Min.X+cx*w/gw, b.Min.X+(cx+1)*w/gw
+			y0, y1 := b.Min.Y+cy*h/gh, b.Min.Y+(cy+1)*h/gh
+			var r, g, bl, n uint64
+			for y := y0; y < y1; y++ {
+				for x := x0; x < x1; x++ {
+					cr, cg, cb, _ := src.At(x, y).RGBA()
+					r, g, bl, n = r+uint64(cr>>8), g+uint64(cg>>8), bl+uint64(cb>>8), n+1
+				}
+			}
+			if n > 0 {
+				cells[cy*gw+cx] = color.RGBA{uint8(r / n), uint8(g / n), uint8(bl / n), 255}
+			}
+		}
+	}
+
+	out := image.NewRGBA(image.Rect(0, 0, ow, oh))
+	for y := 0; y < oh; y++ {
+		for x := 0; x < ow; x++ {
+			out.SetRGBA(x, y, cells[(y*gh/oh)*gw+x*gw/ow])
+		}
+	}
+	return out
+}
+
+// GET /likes/previews/{token} — размытое фото того, кто лайкнул (без авторизации, по подписи)
+func handleLikesYouPreview(w http.ResponseWriter, r *http.Request) {
+	viewerID, photoID, err := parsePreviewToken(chi.URLParam(r, "token"), time.Now())
+	if err != nil {
+		writeError(w, http.StatusNotFound, "Preview not found")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	// только пока лайк ещё висит неотвеченным
+	var dataURL string
+	err = db.QueryRow(ctx, `
+		SELECT p."url"
+		FROM "Photo" p
+		JOIN "ConnectionSide" cs ON cs."userId" = $1 AND cs."otherUserId" = p."userId"
+		WHERE p."id" = $2
+		  AND `+previewablePhotoSQL+`
+		  AND cs."otherAction" = 'LIKED'
+		  AND cs."action" IS NULL
+		  AND cs."matchedAt" IS NULL
+	`, viewerID, photoID).Scan(&dataURL)
+	if errors.Is(err, pgx.ErrNoRows) {
+		writeError(w, http.StatusNotFound, "Preview not found")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to load preview")
+		return
+	}
+
+	img, err := decodeDataURLImage(dataURL)
+	if err != nil {
+		writeError(w, http.StatusNotFound, "Preview not found")
+		return
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, pixelate(img), &jpeg.Options{Quality: 70}); err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to render preview")
+		return
+	}
+
+	w.Header().Set("Content-Type", "image/jpeg")
+	w.Header().Set("Cache-Control", "private, max-age="+strconv.Itoa(int(previewTokenTTL.Seconds())))
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(buf.Bytes())
+}
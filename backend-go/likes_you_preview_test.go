@@ -0,0 +1,67 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPreviewToken(t *testing.T) {
+	setJWTSecret("test-secret")
+	now := time.Unix(1_700_000_000, 0)
+	token := signPreviewToken(7, 42, now.Add(time.Hour))
+
+	viewer, photo, err := parsePreviewToken(token, now)
+	if err != nil || viewer != 7 || photo != 42 {
+		t.Fatalf("round trip: got %d, %d, %v", viewer, photo, err)
+	}
+
+	if _, _, err := parsePreviewToken(token, now.Add(2*time.Hour)); err == nil {
+		t.Error("expired token accepted")
+	}
+
+	payload, sig, _ := strings.Cut(token, ".")
+	forged := signPreviewToken(7, 43, now.Add(time.Hour))
+	forgedPayload, _, _ := strings.Cut(forged, ".")
+	if _, _, err := parsePreviewToken(forgedPayload+"."+sig, now); err == nil {
+		t.Error("token with a swapped payload accepted")
+	}
+	if _, _, err := parsePreviewToken(payload, now); err == nil {
+		t.Error("token without a signature accepted")
+	}
+
+	setJWTSecret("other-secret")
+	if _, _, err := parsePreviewToken(token, now); err == nil {
+		t.Error("token signed with another secret accepted")
+	}
+}
+
+func TestPixelateHidesDetail(t *testing.T) {
+	// шахматка 1px: после мозаики не должно остаться ни одной чёрной или белой точки
+	src := image.NewRGBA(image.Rect(0, 0, 480, 360))
+	for y := 0; y < 360; y++ {
+		for x := 0; x < 480; x++ {
+			if (x+y)%2 == 0 {
+				src.Set(x, y, color.White)
+			} else {
+				src.Set(x, y, color.Black)
+			}
+		}
+	}
+
+	out := pixelate(src)
+	b := out.Bounds()
+	if b.Dx() != previewSize || b.Dy() != previewSize*360/480 {
+		t.Fatalf("size %dx%d", b.Dx(), b.Dy())
+	}
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			r, _, _, _ := out.At(x, y).RGBA()
+			if r>>8 < 100 || r>>8 > 155 {
+				t.Fatalf("pixel (%d,%d) = %d, want a grey average", x, y, r>>8)
+			}
+		}
+	}
+}
@@ -2,8 +2,12 @@ package main
 
 import (
 	"context"
+	"errors"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/go-chi/chi/v5"
@@ -12,10 +16,40 @@ import (
 
 func main() {
 	cfg := LoadConfig()
+	appConfig = cfg
 	setJWTSecret(cfg.JWTSecret)
 	InitDB(cfg.DBURL)
 	defer CloseDB()
 
+	if err := loadExperiments(cfg.ExperimentsFile); err != nil {
+		log.Fatalf("failed to load experiments: %v", err)
+	}
+	initEntitlements(cfg)
+	if err := initPayments(cfg); err != nil {
+		log.Fatalf("failed to init payments: %v", err)
+	}
+	if err := initChatPolicy(cfg); err != nil {
+		log.Fatalf("failed to init chat policy: %v", err)
+	}
+
+	// SIGINT/SIGTERM — плавная остановка
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// фоновый пересчёт очередей рекомендаций
+	go runRecommendationWorker(ctx, cfg)
+	// пополнение суперлайков по расписанию
+	go runSuperLikeRefillWorker(ctx, cfg)
+	// пачечная запись лога показов/свайпов; останавливается после HTTP-сервера,
+	// чтобы успеть записать события последних запросов
+	initEventLog(cfg)
+	eventsCtx, stopEvents := context.WithCancel(context.Background())
+	eventsDone := make(chan struct{})
+	go func() {
+		runEventLogWriter(eventsCtx, cfg)
+		close(eventsDone)
+	}()
+
 	r := chi.NewRouter()
 	r.Use(middleware.Logger)
 	r.Use(middleware.Recoverer)
@@ -49,9 +83,18 @@ func main() {
 	r.Post("/auth/login", handleLogin)
 	r.Post("/auth/logout", handleLogout)
 
+	// размытые превью "кто меня лайкнул": грузятся через <img>, доступ по подписанному токену
+	r.Get("/likes/previews/{token}", handleLikesYouPreview)
+
+	// вебхуки платёжных провайдеров, подпись проверяет провайдер
+	if paymentsEnabled() {
+		r.Post("/payments/webhooks/{provider}", handlePaymentWebhook)
+	}
+
 	// === PROTECTED ===
 	r.Group(func(r chi.Router) {
 		r.Use(authMiddleware)
+		r.Use(activeAccountMiddleware)
 
 		// me
 		r.Get("/me", handleGetMe)
@@ -61,13 +104,32 @@ func main() {
 		r.Get("/me/profile", handleGetMyProfile)
 		r.Put("/me/profile", handleUpdateMyProfile)
 		r.Get("/me/preferences", handleGetMyPreferences)
+		r.Get("/me/quotas", handleGetMyQuotas)
+		r.Get("/me/boosts", handleGetMyBoosts)
+		r.Post("/me/boosts", handleActivateBoost)
 		r.Put("/me/preferences", handleUpdateMyPreferences)
 		r.Post("/me/photos", handleUploadPhoto)
+		r.Get("/me/blocks", handleGetMyBlocks)
+		r.Get("/me/likes", handleGetLikesYou)
+		r.Get("/me/subscription", handleGetMySubscription)
+		if paymentsEnabled() {
+			r.Post("/me/subscription", handleCreateSubscription)
+			r.Delete("/me/subscription", handleCancelSubscription)
+			if cfg.PaymentsDevMode {
+				r.Post("/me/subscription/simulate/{event}", handleSimulateSubscriptionEvent)
+			}
+
+			// plans
+			r.Get("/plans", handleGetPlans)
+		}
 
 		// users
 		r.Get("/users/{id}", handleGetUser)
 		r.Get("/users/{id}/bio", handleGetUserBio)
 		r.Get("/users/{id}/profile", handleGetUserProfile)
+		r.Post("/users/{id}/block", handleBlockUser)
+		r.Delete("/users/{id}/block", handleUnblockUser)
+		r.Post("/users/{id}/report", handleReportUser)
 
 		// recommendations
 		r.Get("/recommendations", handleGetRecommendations)
@@ -75,8 +137,11 @@ func main() {
 		// connections
 		r.Get("/connections", handleGetConnections)
 		r.Get("/connections/requests", handleGetConnectionRequests)
+		r.Get("/connections/history", handleGetConnectionHistory)
+		r.Post("/connections/rewind", handleRewindSwipe)
 		r.Post("/connections/{id}/like", handleLikeUser)
 		r.Post("/connections/{id}/dislike", handleDislikeUser)
+		r.Post("/connections/{id}/superlike", handleSuperLikeUser)
 		r.Post("/connections/{id}/accept", handleAcceptConnection)
 		r.Post("/connections/{id}/reject", handleRejectConnection)
 		r.Post("/connections/{id}/disconnect", handleDisconnectConnection)
@@ -89,7 +154,25 @@ func main() {
 		r.Get("/chats/{id}/messages", handleGetChatMessages)
 		r.Post("/chats/{id}/messages", handleSendChatMessage)
 		r.Post("/chats/with/{userId}", handleEnsureChatWith)
+		r.Post("/chats/{id}/messages/{msgId}/report", handleReportMessage)
+		r.Post("/chats/groups", handleCreateGroupChat)
+		r.Put("/chats/{id}", handleUpdateGroupChat)
+		r.Get("/chats/{id}/members", handleGetChatMembers)
+		r.Post("/chats/{id}/members", handleAddChatMembers)
+		r.Put("/chats/{id}/members/{userId}", handleUpdateChatMember)
+		r.Delete("/chats/{id}/members/{userId}", handleRemoveChatMember)
+		r.Post("/chats/{id}/leave", handleLeaveChat)
 		r.Get("/presence", handlePresence)
+
+		// moderation
+		r.Route("/moderation", func(r chi.Router) {
+			r.Use(moderatorOnly)
+			r.Get("/reports", handleGetModerationReports)
+			r.Get("/reports/{id}", handleGetModerationReport)
+			r.Post("/reports/{id}/actions", handleModerationAction)
+			r.Post("/reports/{id}/resolve", handleResolveReport)
+			r.Get("/users/{id}/connections", handleGetModerationConnectionHistory)
+		})
 	})
 
 	addr := ":" + cfg.Port
@@ -101,6 +184,26 @@ func main() {
 		IdleTimeout:  60 * time.Second,
 	}
 
-	log.Printf("Go backend running on http://localhost:%s", cfg.Port)
-	log.Fatal(srv.ListenAndServe())
+	go func() {
+		log.Printf("Go backend running on http://localhost:%s", cfg.Port)
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatal(err)
+		}
+	}()
+
+	<-ctx.Done()
+	log.Printf("Shutting down...")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Printf("HTTP shutdown: %v", err)
+	}
+
+	stopEvents()
+	select {
+	case <-eventsDone:
+	case <-time.After(30 * time.Second):
+		log.Printf("event log: drain timed out, some events may be lost")
+	}
 }
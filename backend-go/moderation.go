@@ -0,0 +1,763 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// ===== жалобы и модерация =====
+//
+// Жалоба хранит снимок доказательств на момент подачи (анкета, сообщение с
+// контекстом), чтобы правка или удаление не стирали их. Когда на юзера
+// набирается ReportEscalationThreshold жалоб от разных людей, его открытые
+// жалобы поднимаются в ESCALATED. Модераторы ("User"."role" = 'MODERATOR')
+// разбирают очередь, применяют меры и закрывают жалобы.
+
+var reportReasons = map[string]bool{
+	"SPAM":                  true,
+	"HARASSMENT":            true,
+	"INAPPROPRIATE_CONTENT": true,
+	"FAKE_PROFILE":          true,
+	"SCAM":                  true,
+	"UNDERAGE":              true,
+	"OTHER":                 true,
+}
+
+const (
+	reportMaxDetails      = 2000
+	reportContextMessages = 5 // сколько предыдущих сообщений чата сохраняем вместе с жалобой
+)
+
+type reportRequest struct {
+	Reason  string `json:"reason"`
+	Details string `json:"details"`
+}
+
+func (b *reportRequest) validate() string {
+	b.Reason = strings.ToUpper(strings.TrimSpace(b.Reason))
+	b.Details = strings.TrimSpace(b.Details)
+	if !reportReasons[b.Reason] {
+		return "Invalid reason"
+	}
+	if len(b.Details) > reportMaxDetails {
+		return "Details are too long"
+	}
+	return ""
+}
+
+// ===== снимки доказательств =====
+
+func snapshotProfile(ctx context.Context, q dbtx, userID int64) (map[string]interface{}, error) {
+	var name, sex string
+	var dob time.Time
+	var aboutMe, goals, location *string
+	var hobbies, languages []string
+	err := q.QueryRow(ctx, `
+		SELECT u."name", u."sex", u."dateOfBirth",
+		       b."aboutMe", b."goals", COALESCE(b."hobbies", '{}'), COALESCE(b."languages", '{}'),
+		       p."location"
+		FROM "User" u
+		LEFT JOIN "Bio" b ON b."userId" = u."id"
+		LEFT JOIN "Profile" p ON p."userId" = u."id"
+		WHERE u."id" = $1
+	`, userID).Scan(&name, &sex, &dob, &aboutMe, &goals, &hobbies, &languages, &location)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := q.Query(ctx, `SELECT "id","url" FROM "Photo" WHERE "userId" = $1 ORDER BY "id"`, userID)
+	if err != nil {
+		return nil, err
+	}
+	photos, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (map[string]interface{}, error) {
+		var id int64
+		var url string
+		err := row.Scan(&id, &url)
+		return map[string]interface{}{"id": id, "url": url}, err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]interface{}{
+		"userId":      userID,
+		"name":        name,
+		"sex":         sex,
+		"dateOfBirth": dob.Format("2006-01-02"),
+		"location":    location,
+		"aboutMe":     aboutMe,
+		"goals":       goals,
+		"hobbies":     hobbies,
+		"languages":   languages,
+		"photos":      photos,
+	}, nil
+}
+
+// сообщение + несколько предыдущих из того же чата
+func snapshotMessage(ctx context.Context, q dbtx, chatID, messageID int64) (map[string]interface{}, int64, error) {
+	var msg chatMessageResponse
+	err := q.QueryRow(ctx, `
+		SELECT "id","chatId","senderId","content","timestamp"
+		FROM "Message"
+		WHERE "id" = $1 AND "chatId" = $2
+	`, messageID, chatID).Scan(&msg.ID, &msg.ChatID, &msg.SenderID, &msg.Content, &msg.Timestamp)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := q.Query(ctx, `
+		SELECT "id","chatId","senderId","content","timestamp"
+		FROM "Message"
+		WHERE "chatId" = $1 AND ("timestamp", "id") < ($2, $3)
+		ORDER BY "timestamp" DESC, "id" DESC
+		LIMIT $4
+	`, chatID, msg.Timestamp, msg.ID, reportContextMessages)
+	if err != nil {
+		return nil, 0, err
+	}
+	before, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (chatMessageResponse, error) {
+		var m chatMessageResponse
+		err := row.Scan(&m.ID, &m.ChatID, &m.SenderID, &m.Content, &m.Timestamp)
+		return m, err
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	// в хронологическом порядке
+	for i, j := 0, len(before)-1; i < j; i, j = i+1, j-1 {
+		before[i], before[j] = before[j], before[i]
+	}
+	if before == nil {
+		before = []chatMessageResponse{}
+	}
+
+	return map[string]interface{}{
+		"message": msg,
+		"context": before,
+	}, msg.SenderID, nil
+}
+
+// createReport пишет жалобу и, если набралось достаточно разных жалобщиков,
+// эскалирует все открытые жалобы на этого юзера
+func createReport(ctx context.Context, q dbtx, reporterID, reportedID int64, chatID, messageID *int64, body reportRequest, evidence map[string]interface{}) (int64, string, error) {
+	raw, err := json.Marshal(evidence)
+	if err != nil {
+		return 0, "", err
+	}
+
+	var id int64
+	err = q.QueryRow(ctx, `
+		INSERT INTO "Report" ("reporterId","reportedUserId","chatId","messageId","reason","details","evidence")
+		VALUES ($1,$2,$3,$4,$5,NULLIF($6,''),$7)
+		RETURNING "id"
+	`, reporterID, reportedID, chatID, messageID, body.Reason, body.Details, raw).Scan(&id)
+	if err != nil {
+		return 0, "", err
+	}
+
+	var reporters int
+	err = q.QueryRow(ctx, `
+		SELECT COUNT(DISTINCT "reporterId")
+		FROM "Report"
+		WHERE "reportedUserId" = $1
+		  AND "status" <> 'DISMISSED'
+	`, reportedID).Scan(&reporters)
+	if err != nil {
+		return 0, "", err
+	}
+
+	status := "OPEN"
+	if threshold := appConfig.ReportEscalationThreshold; threshold > 0 && reporters >= threshold {
+		tag, err := q.Exec(ctx, `
+			UPDATE "Report"
+			SET "status" = 'ESCALATED'
+			WHERE "reportedUserId" = $1 AND "status" = 'OPEN'
+		`, reportedID)
+		if err != nil {
+			return 0, "", err
+		}
+		status = "ESCALATED"
+		if tag.RowsAffected() > 0 {
+			log.Printf("moderation: user %d escalated after reports from %d users", reportedID, reporters)
+		}
+	}
+	return id, status, nil
+}
+
+// POST /users/{id}/report
+func handleReportUser(w http.ResponseWriter, r *http.Request) {
+	userID, ok := getUserIDFromContext(r)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "Authentication required")
+		return
+	}
+
+	targetID, ok := parseIDParam(r, "id")
+	if !ok {
+		writeError(w, http.StatusBadRequest, "Invalid user id")
+		return
+	}
+	if targetID == userID {
+		writeError(w, http.StatusBadRequest, "Cannot report yourself")
+		return
+	}
+
+	var body reportRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid JSON")
+		return
+	}
+	if msg := body.validate(); msg != "" {
+		writeError(w, http.StatusBadRequest, msg)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to start transaction")
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	profile, err := snapshotProfile(ctx, tx, targetID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		writeError(w, http.StatusNotFound, "User not found")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to snapshot profile")
+		return
+	}
+
+	id, status, err := createReport(ctx, tx, userID, targetID, nil, nil, body, map[string]interface{}{
+		"profile": profile,
+	})
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to create report")
+		return
+	}
+	if err := tx.Commit(ctx); err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to create report")
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, map[string]interface{}{
+		"id":     id,
+		"status": status,
+	})
+}
+
+// POST /chats/{id}/messages/{msgId}/report
+func handleReportMessage(w http.ResponseWriter, r *http.Request) {
+	userID, ok := getUserIDFromContext(r)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "Authentication required")
+		return
+	}
+
+	chatID, ok := parseIDParam(r, "id")
+	if !ok {
+		writeError(w, http.StatusBadRequest, "Invalid chat id")
+		return
+	}
+	messageID, ok := parseIDParam(r, "msgId")
+	if !ok {
+		writeError(w, http.StatusBadRequest, "Invalid message id")
+		return
+	}
+
+	var body reportRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid JSON")
+		return
+	}
+	if msg := body.validate(); msg != "" {
+		writeError(w, http.StatusBadRequest, msg)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to start transaction")
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	// жаловаться можно только на сообщения из своего чата
+	var member bool
+	err = tx.QueryRow(ctx, `
+		SELECT EXISTS(
+			SELECT 1 FROM "ChatUser"
+			WHERE "chatId" = $1 AND "userId" = $2
+		)
+	`, chatID, userID).Scan(&member)
+	if err != nil || !member {
+		writeError(w, http.StatusNotFound, "Chat not found")
+		return
+	}
+
+	message, senderID, err := snapshotMessage(ctx, tx, chatID, messageID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		writeError(w, http.StatusNotFound, "Message not found")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to snapshot message")
+		return
+	}
+	if senderID == userID {
+		writeError(w, http.StatusBadRequest, "Cannot report your own message")
+		return
+	}
+
+	profile, err := snapshotProfile(ctx, tx, senderID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to snapshot profile")
+		return
+	}
+
+	id, status, err := createReport(ctx, tx, userID, senderID, &chatID, &messageID, body, map[string]interface{}{
+		"profile": profile,
+		"message": message,
+	})
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to create report")
+		return
+	}
+	if err := tx.Commit(ctx); err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to create report")
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, map[string]interface{}{
+		"id":     id,
+		"status": status,
+	})
+}
+
+// ===== ограничения аккаунта =====
+
+// accountRestriction — почему юзеру сейчас нельзя пользоваться приложением ("" — можно)
+func accountRestriction(ctx context.Context, userID int64) (string, error) {
+	var banned bool
+	var suspendedUntil *time.Time
+	err := db.QueryRow(ctx, `
+		SELECT "bannedAt" IS NOT NULL, "suspendedUntil"
+		FROM "User"
+		WHERE "id" = $1
+	`, userID).Scan(&banned, &suspendedUntil)
+	if err != nil {
+		return "", err
+	}
+	if banned {
+		return "Account is banned", nil
+	}
+	if suspendedUntil != nil && suspendedUntil.After(time.Now()) {
+		return "Account is suspended until " + suspendedUntil.UTC().Format(time.RFC3339), nil
+	}
+	return "", nil
+}
+
+// activeAccountMiddleware — после authMiddleware: забаненным и приостановленным 403
+func activeAccountMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := getUserIDFromContext(r)
+		if !ok {
+			writeError(w, http.StatusUnauthorized, "Authentication required")
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), 2*time.Second)
+		reason, err := accountRestriction(ctx, userID)
+		cancel()
+		if errors.Is(err, pgx.ErrNoRows) {
+			writeError(w, http.StatusUnauthorized, "Invalid token payload")
+			return
+		}
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "Failed to check account")
+			return
+		}
+		if reason != "" {
+			writeError(w, http.StatusForbidden, reason)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func moderatorOnly(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := getUserIDFromContext(r)
+		if !ok {
+			writeError(w, http.StatusUnauthorized, "Authentication required")
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), 2*time.Second)
+		var role string
+		err := db.QueryRow(ctx, `SELECT "role" FROM "User" WHERE "id" = $1`, userID).Scan(&role)
+		cancel()
+		if err != nil || role != "MODERATOR" {
+			writeError(w, http.StatusForbidden, "Moderator access required")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// ===== очередь модерации =====
+
+type reportResponse struct {
+	ID             int64           `json:"id"`
+	ReporterID     int64           `json:"reporterId"`
+	ReportedUserID int64           `json:"reportedUserId"`
+	ChatID         *int64          `json:"chatId"`
+	MessageID      *int64          `json:"messageId"`
+	Reason         string          `json:"reason"`
+	Details        *string         `json:"details"`
+	Status         string          `json:"status"`
+	Reporters      int             `json:"distinctReporters"` // сколько разных людей жаловались на этого юзера
+	Evidence       json.RawMessage `json:"evidence,omitempty"`
+	CreatedAt      time.Time       `json:"createdAt"`
+	ResolvedAt     *time.Time      `json:"resolvedAt"`
+	ResolvedBy     *int64          `json:"resolvedBy"`
+	Resolution     *string         `json:"resolution"`
+}
+
+const reportColumns = `
+	r."id", r."reporterId", r."reportedUserId", r."chatId", r."messageId",
+	r."reason", r."details", r."status",
+	(
+		SELECT COUNT(DISTINCT o."reporterId")
+		FROM "Report" o
+		WHERE o."reportedUserId" = r."reportedUserId" AND o."status" <> 'DISMISSED'
+	),
+	r."createdAt", r."resolvedAt", r."resolvedBy", r."resolution"`
+
+func scanReport(row pgx.CollectableRow) (reportResponse, error) {
+	var rep reportResponse
+	err := row.Scan(&rep.ID, &rep.ReporterID, &rep.ReportedUserID, &rep.ChatID, &rep.MessageID,
+		&rep.Reason, &rep.Details, &rep.Status, &rep.Reporters,
+		&rep.CreatedAt, &rep.ResolvedAt, &rep.ResolvedBy, &rep.Resolution)
+	return rep, err
+}
+
+// GET /moderation/reports?status=OPEN|ESCALATED|RESOLVED|DISMISSED
+// по умолчанию — всё, что ещё не закрыто: сначала эскалированные, потом самые старые
+func handleGetModerationReports(w http.ResponseWriter, r *http.Request) {
+	status := strings.ToUpper(strings.TrimSpace(r.URL.Query().Get("status")))
+	switch status {
+	case "", "OPEN", "ESCALATED", "RESOLVED", "DISMISSED":
+	default:
+		writeError(w, http.StatusBadRequest, "Invalid status")
+		return
+	}
+
+	limit := 50
+	if l, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && l > 0 && l <= 200 {
+		limit = l
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	rows, err := db.Query(ctx, `
+		SELECT `+reportColumns+`
+		FROM "Report" r
+		WHERE ($1 = '' AND r."status" IN ('OPEN','ESCALATED')) OR r."status" = $1
+		ORDER BY (r."status" = 'ESCALATED') DESC, r."createdAt" ASC
+		LIMIT $2
+	`, status, limit)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to load reports")
+		return
+	}
+	reports, err := pgx.CollectRows(rows, scanReport)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to scan reports")
+		return
+	}
+	if reports == nil {
+		reports = []reportResponse{}
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"reports": reports,
+	})
+}
+
+type moderationActionResponse struct {
+	ID          int64      `json:"id"`
+	ReportID    *int64     `json:"reportId"`
+	ModeratorID int64      `json:"moderatorId"`
+	UserID      int64      `json:"userId"`
+	Action      string     `json:"action"`
+	PhotoID     *int64     `json:"photoId"`
+	Until       *time.Time `json:"until"`
+	Note        *string    `json:"note"`
+	CreatedAt   time.Time  `json:"createdAt"`
+}
+
+// GET /moderation/reports/{id} — жалоба с доказательствами и историей мер по юзеру
+func handleGetModerationReport(w http.ResponseWriter, r *http.Request) {
+	reportID, ok := parseIDParam(r, "id")
+	if !ok {
+		writeError(w, http.StatusBadRequest, "Invalid report id")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	rows, err := db.Query(ctx, `
+		SELECT `+reportColumns+`, r."evidence"
+		FROM "Report" r
+		WHERE r."id" = $1
+	`, reportID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to load report")
+		return
+	}
+	rep, err := pgx.CollectExactlyOneRow(rows, func(row pgx.CollectableRow) (reportResponse, error) {
+		var rep reportResponse
+		err := row.Scan(&rep.ID, &rep.ReporterID, &rep.ReportedUserID, &rep.ChatID, &rep.MessageID,
+			&rep.Reason, &rep.Details, &rep.Status, &rep.Reporters,
+			&rep.CreatedAt, &rep.ResolvedAt, &rep.ResolvedBy, &rep.Resolution, &rep.Evidence)
+		return rep, err
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		writeError(w, http.StatusNotFound, "Report not found")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to load report")
+		return
+	}
+
+	rows, err = db.Query(ctx, `
+		SELECT "id","reportId","moderatorId","userId","action","photoId","until","note","createdAt"
+		FROM "ModerationAction"
+		WHERE "userId" = $1
+		ORDER BY "createdAt" DESC
+	`, rep.ReportedUserID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to load moderation history")
+		return
+	}
+	history, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (moderationActionResponse, error) {
+		var a moderationActionResponse
+		err := row.Scan(&a.ID, &a.ReportID, &a.ModeratorID, &a.UserID, &a.Action, &a.PhotoID, &a.Until, &a.Note, &a.CreatedAt)
+		return a, err
+	})
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to scan moderation history")
+		return
+	}
+	if history == nil {
+		history = []moderationActionResponse{}
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"report":  rep,
+		"actions": history,
+	})
+}
+
+type moderationActionRequest struct {
+	Action        string `json:"action"` // WARN / SUSPEND / BAN / REMOVE_PHOTO
+	Note          string `json:"note"`
+	DurationHours int    `json:"durationHours"` // для SUSPEND
+	PhotoID       int64  `json:"photoId"`       // для REMOVE_PHOTO
+}
+
+// POST /moderation/reports/{id}/actions — применить меру к юзеру из жалобы
+func handleModerationAction(w http.ResponseWriter, r *http.Request) {
+	moderatorID, _ := getUserIDFromContext(r)
+
+	reportID, ok := parseIDParam(r, "id")
+	if !ok {
+		writeError(w, http.StatusBadRequest, "Invalid report id")
+		return
+	}
+
+	var body moderationActionRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid JSON")
+		return
+	}
+	body.Action = strings.ToUpper(strings.TrimSpace(body.Action))
+	body.Note = strings.TrimSpace(body.Note)
+
+	switch body.Action {
+	case "WARN", "BAN":
+	case "SUSPEND":
+		if body.DurationHours <= 0 {
+			writeError(w, http.StatusBadRequest, "durationHours must be positive")
+			return
+		}
+	case "REMOVE_PHOTO":
+		if body.PhotoID <= 0 {
+			writeError(w, http.StatusBadRequest, "photoId is required")
+			return
+		}
+	default:
+		writeError(w, http.StatusBadRequest, "Invalid action")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to start transaction")
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	var targetID int64
+	var status string
+	err = tx.QueryRow(ctx, `
+		SELECT "reportedUserId","status" FROM "Report" WHERE "id" = $1 FOR UPDATE
+	`, reportID).Scan(&targetID, &status)
+	if errors.Is(err, pgx.ErrNoRows) {
+		writeError(w, http.StatusNotFound, "Report not found")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to load report")
+		return
+	}
+
+	var until *time.Time
+	var photoID *int64
+	switch body.Action {
+	case "SUSPEND":
+		t := time.Now().Add(time.Duration(body.DurationHours) * time.Hour)
+		until = &t
+		_, err = tx.Exec(ctx, `
+			UPDATE "User"
+			SET "suspendedUntil" = GREATEST(COALESCE("suspendedUntil", $2), $2)
+			WHERE "id" = $1
+		`, targetID, t)
+	case "BAN":
+		_, err = tx.Exec(ctx, `
+			UPDATE "User" SET "bannedAt" = COALESCE("bannedAt", NOW()) WHERE "id" = $1
+		`, targetID)
+	case "REMOVE_PHOTO":
+		photoID = &body.PhotoID
+		tag, execErr := tx.Exec(ctx, `
+			DELETE FROM "Photo" WHERE "id" = $1 AND "userId" = $2
+		`, body.PhotoID, targetID)
+		err = execErr
+		if err == nil && tag.RowsAffected() == 0 {
+			writeError(w, http.StatusNotFound, "Photo not found")
+			return
+		}
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to apply action")
+		return
+	}
+
+	var a moderationActionResponse
+	err = tx.QueryRow(ctx, `
+		INSERT INTO "ModerationAction" ("reportId","moderatorId","userId","action","photoId","until","note")
+		VALUES ($1,$2,$3,$4,$5,$6,NULLIF($7,''))
+		RETURNING "id","reportId","moderatorId","userId","action","photoId","until","note","createdAt"
+	`, reportID, moderatorID, targetID, body.Action, photoID, until, body.Note).Scan(
+		&a.ID, &a.ReportID, &a.ModeratorID, &a.UserID, &a.Action, &a.PhotoID, &a.Until, &a.Note, &a.CreatedAt)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to record action")
+		return
+	}
+	if err := tx.Commit(ctx); err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to apply action")
+		return
+	}
+
+	switch body.Action {
+	case "WARN":
+		wsSendToUser(targetID, wsOutgoing{Type: "moderation_warning", Text: body.Note})
+	case "SUSPEND", "BAN":
+		// из чужих очередей его выкидывает readRecommendationQueue,
+		// а пересчёт уберёт его оттуда насовсем
+		markCandidateQueuesStale(ctx, targetID)
+	case "REMOVE_PHOTO":
+		markCandidateQueuesStale(ctx, targetID)
+	}
+
+	writeJSON(w, http.StatusCreated, map[string]interface{}{
+		"action": a,
+	})
+}
+
+type resolveReportRequest struct {
+	Outcome    string `json:"outcome"` // RESOLVED / DISMISSED
+	Resolution string `json:"resolution"`
+}
+
+// POST /moderation/reports/{id}/resolve
+func handleResolveReport(w http.ResponseWriter, r *http.Request) {
+	moderatorID, _ := getUserIDFromContext(r)
+
+	reportID, ok := parseIDParam(r, "id")
+	if !ok {
+		writeError(w, http.StatusBadRequest, "Invalid report id")
+		return
+	}
+
+	var body resolveReportRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid JSON")
+		return
+	}
+	body.Outcome = strings.ToUpper(strings.TrimSpace(body.Outcome))
+	if body.Outcome == "" {
+		body.Outcome = "RESOLVED"
+	}
+	if body.Outcome != "RESOLVED" && body.Outcome != "DISMISSED" {
+		writeError(w, http.StatusBadRequest, "outcome must be RESOLVED or DISMISSED")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	var resolvedAt time.Time
+	err := db.QueryRow(ctx, `
+		UPDATE "Report"
+		SET "status" = $2, "resolvedAt" = NOW(), "resolvedBy" = $3, "resolution" = NULLIF($4,'')
+		WHERE "id" = $1 AND "status" IN ('OPEN','ESCALATED')
+		RETURNING "resolvedAt"
+	`, reportID, body.Outcome, moderatorID, strings.TrimSpace(body.Resolution)).Scan(&resolvedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		writeError(w, http.StatusNotFound, "Open report not found")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to resolve report")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"id":         reportID,
+		"status":     body.Outcome,
+		"resolvedAt": resolvedAt,
+	})
+}
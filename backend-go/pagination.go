@@ -0,0 +1,129 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ===== keyset-пагинация =====
+//
+// Курсор — base64(JSON) со значениями ключей сортировки последней отданной
+// строки и её id. Значения храним текстом (так их отдаёт SQL через ::text) и
+// приводим обратно к типу ключа в запросе.
+
+var errInvalidCursor = errors.New("invalid cursor")
+
+// keysetSort — порядок выдачи: ключи, затем id; все в одну сторону,
+// чтобы работало сравнение строк (k1, k2, id) < (...)
+type keysetSort struct {
+	keys  []string // SQL-выражения
+	types []string // типы ключей для приведения значений курсора
+	id    string   // уникальный tie-break
+	desc  bool
+}
+
+func (s keysetSort) orderBy() string {
+	dir := "ASC"
+	if s.desc {
+		dir = "DESC"
+	}
+	parts := make([]string, 0, len(s.keys)+1)
+	for _, k := range append(append([]string{}, s.keys...), s.id) {
+		parts = append(parts, k+" "+dir)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// cursorKeys — выражение, которое достаёт из строки значения ключей для курсора
+func (s keysetSort) cursorKeys() string {
+	parts := make([]string, len(s.keys))
+	for i, k := range s.keys {
+		parts[i] = "(" + k + ")::text"
+	}
+	return "ARRAY[" + strings.Join(parts, ", ") + "]::text[]"
+}
+
+// after — условие "строка после курсора"; параметры: $n — text[] ключей, $n+1 — id.
+// Без курсора ($n IS NULL) условие истинно.
+func (s keysetSort) after(n int) string {
+	op := ">"
+	if s.desc {
+		op = "<"
+	}
+	vals := make([]string, len(s.keys))
+	for i, t := range s.types {
+		vals[i] = fmt.Sprintf("($%d::text[])[%d]::%s", n, i+1, t)
+	}
+	return fmt.Sprintf("($%d::text[] IS NULL OR (%s, %s) %s (%s, $%d))",
+		n, strings.Join(s.keys, ", "), s.id, op, strings.Join(vals, ", "), n+1)
+}
+
+type listCursor struct {
+	Sort string   `json:"s"`
+	Keys []string `json:"k"`
+	ID   int64    `json:"id"`
+}
+
+func encodeCursor(sortName string, keys []string, id int64) string {
+	raw, _ := json.Marshal(listCursor{Sort: sortName, Keys: keys, ID: id})
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+// decodeCursor — пустая строка значит "с начала" (nil, 0); курсор от другой сортировки не принимаем
+func decodeCursor(s, sortName string, ks keysetSort) ([]string, int64, error) {
+	if s == "" {
+		return nil, 0, nil
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, 0, errInvalidCursor
+	}
+	var c listCursor
+	if err := json.Unmarshal(raw, &c); err != nil || c.Sort != sortName || len(c.Keys) != len(ks.keys) {
+		return nil, 0, errInvalidCursor
+	}
+	return c.Keys, c.ID, nil
+}
+
+// pageParams — ?limit=&cursor=&sort=; sort выбирается из sorts, по умолчанию def
+type pageParams struct {
+	limit      int
+	sortName   string
+	sort       keysetSort
+	cursorKeys []string
+	cursorID   int64
+}
+
+func parsePageParams(r *http.Request, sorts map[string]keysetSort, def string) (pageParams, string) {
+	q := r.URL.Query()
+	p := pageParams{limit: 20, sortName: def}
+	if l, err := strconv.Atoi(q.Get("limit")); err == nil && l > 0 && l <= 100 {
+		p.limit = l
+	}
+	if s := strings.ToLower(strings.TrimSpace(q.Get("sort"))); s != "" {
+		p.sortName = s
+	}
+	ks, ok := sorts[p.sortName]
+	if !ok {
+		names := make([]string, 0, len(sorts))
+		for name := range sorts {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return p, "Unknown sort, expected one of: " + strings.Join(names, ", ")
+	}
+	p.sort = ks
+
+	keys, id, err := decodeCursor(q.Get("cursor"), p.sortName, ks)
+	if err != nil {
+		return p, "Invalid cursor"
+	}
+	p.cursorKeys, p.cursorID = keys, id
+	return p, ""
+}
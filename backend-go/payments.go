@@ -0,0 +1,237 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+)
+
+// ===== платёжные провайдеры =====
+//
+// Провайдер умеет начать и отменить подписку, а обо всём остальном сообщает
+// вебхуками: purchased, renewed, canceled, expired. Все события идут через
+// processPaymentWebhook — и настоящие HTTP-вебхуки, и события fake-провайдера,
+// так что жизненный цикл подписки одинаков в проде и офлайн.
+
+const (
+	paymentEventPurchased = "subscription.purchased"
+	paymentEventRenewed   = "subscription.renewed"
+	paymentEventCanceled  = "subscription.canceled"
+	paymentEventExpired   = "subscription.expired"
+)
+
+const paymentSignatureHeader = "X-Payment-Signature"
+
+var (
+	errInvalidWebhookSignature = errors.New("invalid webhook signature")
+	errInvalidPaymentEvent     = errors.New("invalid payment event")
+)
+
+// paymentEvent — событие провайдера в нашем формате
+type paymentEvent struct {
+	ID             string    `json:"id"`
+	Type           string    `json:"type"`
+	SubscriptionID string    `json:"subscriptionId"` // id подписки у провайдера
+	UserID         int64     `json:"userId,omitempty"`
+	PlanID         string    `json:"planId,omitempty"`
+	PeriodStart    time.Time `json:"periodStart"` // purchased, renewed
+	PeriodEnd      time.Time `json:"periodEnd"`
+	OccurredAt     time.Time `json:"occurredAt"`
+}
+
+type paymentProvider interface {
+	Name() string
+	// StartSubscription оформляет подписку; в базе она появится по событию purchased
+	StartSubscription(ctx context.Context, userID int64, plan subscriptionPlan) (string, error)
+	// CancelSubscription выключает автопродление; придёт canceled
+	CancelSubscription(ctx context.Context, providerSubscriptionID string) error
+	// ParseWebhook проверяет подпись и разбирает тело вебхука
+	ParseWebhook(body []byte, signature string) (paymentEvent, error)
+}
+
+// paymentSimulator — провайдер, которому можно скомандовать продление и истечение (fake)
+type paymentSimulator interface {
+	SimulateRenewal(ctx context.Context, sub userSubscription, plan subscriptionPlan) error
+	SimulateExpiry(ctx context.Context, sub userSubscription) error
+}
+
+var (
+	paymentProviders       = map[string]paymentProvider{}
+	defaultPaymentProvider paymentProvider
+)
+
+// paymentsEnabled — настроен ли провайдер; без него маршруты покупки не регистрируются
+func paymentsEnabled() bool {
+	return defaultPaymentProvider != nil
+}
+
+func initPayments(cfg Config) error {
+	switch cfg.PaymentProvider {
+	case "":
+		log.Printf("payments: PAYMENT_PROVIDER is not set, subscriptions are disabled")
+		return nil
+	case "fake":
+		// fake выдаёт подписку без оплаты — только для разработки
+		if !cfg.PaymentsDevMode {
+			return errors.New(`payment provider "fake" requires PAYMENTS_DEV_MODE=true`)
+		}
+		log.Printf("payments: using the fake provider, subscriptions are free (PAYMENTS_DEV_MODE)")
+		p := newFakePaymentProvider(cfg.PaymentWebhookSecret)
+		p.send = func(ctx context.Context, body []byte, signature string) error {
+			return processPaymentWebhook(ctx, p, body, signature)
+		}
+		defaultPaymentProvider = p
+	default:
+		return fmt.Errorf("unknown payment provider %q", cfg.PaymentProvider)
+	}
+	paymentProviders[defaultPaymentProvider.Name()] = defaultPaymentProvider
+	return nil
+}
+
+func processPaymentWebhook(ctx context.Context, p paymentProvider, body []byte, signature string) error {
+	ev, err := p.ParseWebhook(body, signature)
+	if err != nil {
+		return err
+	}
+	if ev.ID == "" || ev.SubscriptionID == "" {
+		return errInvalidPaymentEvent
+	}
+	return applyPaymentEvent(ctx, p.Name(), ev, body)
+}
+
+// applyPaymentEvent применяет событие к "Subscription" ровно один раз.
+// Событие о неизвестной подписке откатывается целиком — провайдер повторит
+// его позже, когда дойдёт purchased.
+func applyPaymentEvent(ctx context.Context, provider string, ev paymentEvent, payload []byte) error {
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	tag, err := tx.Exec(ctx, `
+		INSERT INTO "PaymentEvent" ("provider","eventId","type","payload")
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT DO NOTHING
+	`, provider, ev.ID, ev.Type, payload)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		// уже обработано
+		return nil
+	}
+
+	if ev.Type == paymentEventPurchased {
+		if ev.UserID == 0 || ev.PeriodEnd.IsZero() {
+			return errInvalidPaymentEvent
+		}
+		if _, err := loadPlan(ctx, tx, ev.PlanID); err != nil {
+			return err
+		}
+		_, err = tx.Exec(ctx, `
+			INSERT INTO "Subscription" ("userId","planId","status","provider","providerSubscriptionId",
+			                            "currentPeriodStart","currentPeriodEnd")
+			VALUES ($1, $2, 'ACTIVE', $3, $4, $5, $6)
+			ON CONFLICT ("provider","providerSubscriptionId") DO NOTHING
+		`, ev.UserID, ev.PlanID, provider, ev.SubscriptionID, ev.PeriodStart, ev.PeriodEnd)
+		if err != nil {
+			return err
+		}
+		return tx.Commit(ctx)
+	}
+
+	var subID int64
+	err = tx.QueryRow(ctx, `
+		SELECT "id" FROM "Subscription"
+		WHERE "provider" = $1 AND "providerSubscriptionId" = $2
+		FOR UPDATE
+	`, provider, ev.SubscriptionID).Scan(&subID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return errUnknownSubscription
+	}
+	if err != nil {
+		return err
+	}
+
+	switch ev.Type {
+	case paymentEventRenewed:
+		if ev.PeriodEnd.IsZero() {
+			return errInvalidPaymentEvent
+		}
+		_, err = tx.Exec(ctx, `
+			UPDATE "Subscription" SET
+				"status" = 'ACTIVE',
+				"canceledAt" = NULL,
+				"currentPeriodStart" = $2,
+				"currentPeriodEnd" = GREATEST("currentPeriodEnd", $3),
+				"updatedAt" = NOW()
+			WHERE "id" = $1
+		`, subID, ev.PeriodStart, ev.PeriodEnd)
+	case paymentEventCanceled:
+		_, err = tx.Exec(ctx, `
+			UPDATE "Subscription" SET
+				"status" = 'CANCELED',
+				"canceledAt" = $2,
+				"updatedAt" = NOW()
+			WHERE "id" = $1 AND "status" = 'ACTIVE'
+		`, subID, ev.OccurredAt)
+	case paymentEventExpired:
+		_, err = tx.Exec(ctx, `
+			UPDATE "Subscription" SET
+				"status" = 'EXPIRED',
+				"currentPeriodEnd" = LEAST("currentPeriodEnd", $2),
+				"updatedAt" = NOW()
+			WHERE "id" = $1
+		`, subID, ev.OccurredAt)
+	default:
+		return errInvalidPaymentEvent
+	}
+	if err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// POST /payments/webhooks/{provider}
+func handlePaymentWebhook(w http.ResponseWriter, r *http.Request) {
+	provider, ok := paymentProviders[chi.URLParam(r, "provider")]
+	if !ok {
+		writeError(w, http.StatusNotFound, "Unknown payment provider")
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Failed to read body")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	err = processPaymentWebhook(ctx, provider, body, r.Header.Get(paymentSignatureHeader))
+	switch {
+	case err == nil:
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"received": true,
+		})
+	case errors.Is(err, errInvalidWebhookSignature):
+		writeError(w, http.StatusUnauthorized, "Invalid signature")
+	case errors.Is(err, errInvalidPaymentEvent), errors.Is(err, errUnknownPlan):
+		writeError(w, http.StatusBadRequest, "Invalid event")
+	case errors.Is(err, errUnknownSubscription):
+		// не 2xx — провайдер пришлёт событие ещё раз
+		writeError(w, http.StatusConflict, "Unknown subscription")
+	default:
+		log.Printf("payment webhook %s: %v", provider.Name(), err)
+		writeError(w, http.StatusInternalServerError, "Failed to process event")
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+)
+
+// ===== fake-провайдер =====
+//
+// Ничего не списывает: на каждое действие сразу формирует подписанное
+// событие и отправляет его в send (по умолчанию — в processPaymentWebhook
+// в этом же процессе). Состояние не хранит: продление и истечение считаются
+// от подписки из базы, поэтому переживают рестарт.
+
+type fakePaymentProvider struct {
+	secret []byte
+	send   func(ctx context.Context, body []byte, signature string) error
+	now    func() time.Time
+}
+
+func newFakePaymentProvider(secret string) *fakePaymentProvider {
+	return &fakePaymentProvider{
+		secret: []byte(secret),
+		now:    time.Now,
+	}
+}
+
+func (p *fakePaymentProvider) Name() string { return "fake" }
+
+func (p *fakePaymentProvider) sign(body []byte) string {
+	mac := hmac.New(sha256.New, p.secret)
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func fakeID(prefix string) string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return prefix + hex.EncodeToString(b)
+}
+
+func (p *fakePaymentProvider) emit(ctx context.Context, ev paymentEvent) error {
+	ev.ID = fakeID("fake_evt_")
+	ev.OccurredAt = p.now()
+	body, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	return p.send(ctx, body, p.sign(body))
+}
+
+func (p *fakePaymentProvider) StartSubscription(ctx context.Context, userID int64, plan subscriptionPlan) (string, error) {
+	subID := fakeID("fake_sub_")
+	start := p.now()
+	err := p.emit(ctx, paymentEvent{
+		Type:           paymentEventPurchased,
+		SubscriptionID: subID,
+		UserID:         userID,
+		PlanID:         plan.ID,
+		PeriodStart:    start,
+		PeriodEnd:      start.AddDate(0, 0, plan.PeriodDays),
+	})
+	return subID, err
+}
+
+func (p *fakePaymentProvider) CancelSubscription(ctx context.Context, providerSubscriptionID string) error {
+	return p.emit(ctx, paymentEvent{
+		Type:           paymentEventCanceled,
+		SubscriptionID: providerSubscriptionID,
+	})
+}
+
+// SimulateRenewal — списание за следующий период: он начинается с конца текущего
+func (p *fakePaymentProvider) SimulateRenewal(ctx context.Context, sub userSubscription, plan subscriptionPlan) error {
+	return p.emit(ctx, paymentEvent{
+		Type:           paymentEventRenewed,
+		SubscriptionID: sub.ProviderSubscriptionID,
+		PeriodStart:    sub.CurrentPeriodEnd,
+		PeriodEnd:      sub.CurrentPeriodEnd.AddDate(0, 0, plan.PeriodDays),
+	})
+}
+
+// SimulateExpiry — подписка закончилась прямо сейчас (неудачное списание, возврат)
+func (p *fakePaymentProvider) SimulateExpiry(ctx context.Context, sub userSubscription) error {
+	return p.emit(ctx, paymentEvent{
+		Type:           paymentEventExpired,
+		SubscriptionID: sub.ProviderSubscriptionID,
+	})
+}
+
+func (p *fakePaymentProvider) ParseWebhook(body []byte, signature string) (paymentEvent, error) {
+	var ev paymentEvent
+	if !hmac.Equal([]byte(p.sign(body)), []byte(signature)) {
+		return ev, errInvalidWebhookSignature
+	}
+	if err := json.Unmarshal(body, &ev); err != nil {
+		return ev, errInvalidPaymentEvent
+	}
+	return ev, nil
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestInitPaymentsFakeNeedsDevMode(t *testing.T) {
+	err := initPayments(Config{PaymentProvider: "fake", PaymentWebhookSecret: "s"})
+	if err == nil {
+		t.Fatal("fake provider started without PAYMENTS_DEV_MODE")
+	}
+}
+
+func TestPaymentsOptional(t *testing.T) {
+	cfg := Config{
+		RecsWorkerInterval:      time.Minute,
+		RecsRefreshInterval:     time.Minute,
+		SuperLikeRefillInterval: time.Minute,
+		EventFlushInterval:      time.Minute,
+	}
+	if err := cfg.validate(); err != nil {
+		t.Fatalf("config without payments: %v", err)
+	}
+	if err := initPayments(cfg); err != nil || paymentsEnabled() {
+		t.Fatalf("no provider: got enabled=%v, %v; want payments disabled", paymentsEnabled(), err)
+	}
+
+	cfg.PaymentProvider = "fake"
+	if err := cfg.validate(); err == nil {
+		t.Fatal("provider without PAYMENT_WEBHOOK_SECRET accepted")
+	}
+}
+
+// fakeDelivery — событие, которое fake-провайдер отправил бы в вебхук
+type fakeDelivery struct {
+	body []byte
+	sig  string
+	ev   paymentEvent
+}
+
+// newTestFakeProvider — fake с ручными часами; события копятся в out и
+// доставляет сам тест, в нужном порядке
+func newTestFakeProvider(now *time.Time, out *[]fakeDelivery) *fakePaymentProvider {
+	p := newFakePaymentProvider("test-webhook-secret")
+	p.now = func() time.Time { return *now }
+	p.send = func(ctx context.Context, body []byte, signature string) error {
+		var ev paymentEvent
+		if err := json.Unmarshal(body, &ev); err != nil {
+			return err
+		}
+		*out = append(*out, fakeDelivery{body: body, sig: signature, ev: ev})
+		return nil
+	}
+	return p
+}
+
+func loadTestSubscription(t *testing.T, ctx context.Context, providerSubID string) userSubscription {
+	t.Helper()
+	s, err := scanSubscription(db.QueryRow(ctx, `
+		SELECT `+subscriptionColumns+`
+		FROM "Subscription"
+		WHERE "provider" = 'fake' AND "providerSubscriptionId" = $1
+	`, providerSubID))
+	if err != nil {
+		t.Fatalf("load subscription: %v", err)
+	}
+	return s
+}
+
+func countPaymentEvents(t *testing.T, ctx context.Context, eventID string) int {
+	t.Helper()
+	var n int
+	err := db.QueryRow(ctx, `
+		SELECT COUNT(*) FROM "PaymentEvent" WHERE "provider" = 'fake' AND "eventId" = $1
+	`, eventID).Scan(&n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+// purchased → renewed → canceled → expired, с повтором события и renewed,
+// пришедшим раньше purchased
+func TestFakePaymentLifecycle(t *testing.T) {
+	ctx := setupTestDB(t)
+	userID := createTestUser(t, ctx)
+	plan, err := loadPlan(ctx, db, "plus")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	var sent []fakeDelivery
+	p := newTestFakeProvider(&now, &sent)
+	deliver := func(d fakeDelivery) error {
+		return processPaymentWebhook(ctx, p, d.body, d.sig)
+	}
+
+	subID, err := p.StartSubscription(ctx, userID, plan)
+	if err != nil {
+		t.Fatal(err)
+	}
+	purchased := sent[0]
+	firstEnd := now.AddDate(0, 0, plan.PeriodDays)
+	if err := p.SimulateRenewal(ctx, userSubscription{ProviderSubscriptionID: subID, CurrentPeriodEnd: firstEnd}, plan); err != nil {
+		t.Fatal(err)
+	}
+	renewed := sent[1]
+
+	// renewed раньше purchased: отказ без следа, провайдер повторит
+	if err := deliver(renewed); !errors.Is(err, errUnknownSubscription) {
+		t.Fatalf("renewed before purchased: got %v, want errUnknownSubscription", err)
+	}
+	if n := countPaymentEvents(t, ctx, renewed.ev.ID); n != 0 {
+		t.Fatalf("rejected renewed left %d PaymentEvent rows", n)
+	}
+
+	if err := deliver(purchased); err != nil {
+		t.Fatalf("purchased: %v", err)
+	}
+	s := loadTestSubscription(t, ctx, subID)
+	if s.Status != subscriptionActive || !s.CurrentPeriodEnd.Equal(firstEnd) {
+		t.Fatalf("after purchased: %s until %s, want ACTIVE until %s", s.Status, s.CurrentPeriodEnd, firstEnd)
+	}
+
+	// повтор renewed после purchased проходит
+	secondEnd := firstEnd.AddDate(0, 0, plan.PeriodDays)
+	if err := deliver(renewed); err != nil {
+		t.Fatalf("renewed retry: %v", err)
+	}
+	s = loadTestSubscription(t, ctx, subID)
+	if s.Status != subscriptionActive || !s.CurrentPeriodStart.Equal(firstEnd) || !s.CurrentPeriodEnd.Equal(secondEnd) {
+		t.Fatalf("after renewed: %s %s..%s, want ACTIVE %s..%s",
+			s.Status, s.CurrentPeriodStart, s.CurrentPeriodEnd, firstEnd, secondEnd)
+	}
+
+	now = now.Add(time.Hour)
+	if err := p.CancelSubscription(ctx, subID); err != nil {
+		t.Fatal(err)
+	}
+	if err := deliver(sent[2]); err != nil {
+		t.Fatalf("canceled: %v", err)
+	}
+	s = loadTestSubscription(t, ctx, subID)
+	if s.Status != subscriptionCanceled || s.CanceledAt == nil || !s.CanceledAt.Equal(now) {
+		t.Fatalf("after canceled: %s canceledAt %v, want CANCELED at %s", s.Status, s.CanceledAt, now)
+	}
+
+	// дубль renewed уже записан в "PaymentEvent" — отмену он не откатывает
+	if err := deliver(renewed); err != nil {
+		t.Fatalf("duplicate renewed: %v", err)
+	}
+	if n := countPaymentEvents(t, ctx, renewed.ev.ID); n != 1 {
+		t.Fatalf("duplicate renewed: %d PaymentEvent rows, want 1", n)
+	}
+	if s = loadTestSubscription(t, ctx, subID); s.Status != subscriptionCanceled {
+		t.Fatalf("duplicate renewed reactivated the subscription: %s", s.Status)
+	}
+
+	// отменённая действует до конца оплаченного периода
+	cur, err := currentSubscription(ctx, userID)
+	if err != nil || cur == nil || cur.ID != s.ID {
+		t.Fatalf("canceled subscription should still be current, got %+v, %v", cur, err)
+	}
+
+	now = now.Add(time.Hour)
+	if err := p.SimulateExpiry(ctx, s); err != nil {
+		t.Fatal(err)
+	}
+	if err := deliver(sent[3]); err != nil {
+		t.Fatalf("expired: %v", err)
+	}
+	s = loadTestSubscription(t, ctx, subID)
+	if s.Status != subscriptionExpired || !s.CurrentPeriodEnd.Equal(now) {
+		t.Fatalf("after expired: %s until %s, want EXPIRED until %s", s.Status, s.CurrentPeriodEnd, now)
+	}
+	if cur, err := currentSubscription(ctx, userID); err != nil || cur != nil {
+		t.Fatalf("expired subscription is still current: %+v, %v", cur, err)
+	}
+}
+
+func TestFakePaymentWebhookSignature(t *testing.T) {
+	ctx := setupTestDB(t)
+	userID := createTestUser(t, ctx)
+	plan, err := loadPlan(ctx, db, "plus")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	var sent []fakeDelivery
+	p := newTestFakeProvider(&now, &sent)
+	subID, err := p.StartSubscription(ctx, userID, plan)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	other := newFakePaymentProvider("another-secret")
+	err = processPaymentWebhook(ctx, other, sent[0].body, sent[0].sig)
+	if !errors.Is(err, errInvalidWebhookSignature) {
+		t.Fatalf("foreign signature: got %v, want errInvalidWebhookSignature", err)
+	}
+	var n int
+	err = db.QueryRow(ctx, `
+		SELECT COUNT(*) FROM "Subscription" WHERE "providerSubscriptionId" = $1
+	`, subID).Scan(&n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 0 {
+		t.Fatal("subscription created from an event with a bad signature")
+	}
+}
@@ -2,14 +2,17 @@
 package main
 
 import (
+	"context"
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
 )
 
 func handlePresence(w http.ResponseWriter, r *http.Request) {
-	// просто убеждаемся, что пользователь авторизован
-	_, ok := getUserIDFromContext(r)
+	userID, ok := getUserIDFromContext(r)
 	if !ok {
 		writeError(w, http.StatusUnauthorized, "Authentication required")
 		return
@@ -39,13 +42,23 @@ func handlePresence(w http.ResponseWriter, r *http.Request) {
 		Online bool  `json:"online"`
 	}
 
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	// заблокированные (в любую сторону) и бывшие матчи всегда offline
+	blocked, err := presenceHiddenWith(ctx, userID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to load blocks")
+		return
+	}
+
 	res := make([]presence, 0, len(ids))
 
 	// безопасно читаем hub.byUser под RLock
 	hub.mu.RLock()
 	for _, id := range ids {
 		conns := hub.byUser[id]
-		online := len(conns) > 0
+		online := len(conns) > 0 && !blocked[id]
 		res = append(res, presence{
 			UserID: id,
 			Online: online,
@@ -57,3 +70,29 @@ func handlePresence(w http.ResponseWriter, r *http.Request) {
 		"presence": res,
 	})
 }
+
+// presenceHiddenWith — кому юзер не виден онлайн: блок в любую сторону
+// или разорванный матч (пока пара не сматчится снова)
+func presenceHiddenWith(ctx context.Context, userID int64) (map[int64]bool, error) {
+	hidden, err := blockedWith(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := db.Query(ctx, `
+		SELECT CASE WHEN "userAId" = $1 THEN "userBId" ELSE "userAId" END
+		FROM "Connection"
+		WHERE ("userAId" = $1 OR "userBId" = $1)
+		  AND "unmatchedAt" IS NOT NULL
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	ids, err := pgx.CollectRows(rows, pgx.RowTo[int64])
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range ids {
+		hidden[id] = true
+	}
+	return hidden, nil
+}
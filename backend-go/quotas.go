@@ -0,0 +1,299 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// ===== дневные лимиты =====
+//
+// Лайки считаются в "DailyLikeCount" по локальной дате юзера
+// ("Profile"."timezone"), так что лимит сбрасывается в его полночь.
+// Границы суток фиксируются первым лайком ("resetsAt") и не двигаются,
+// если юзер потом сменит часовой пояс — иначе смена пояса сбрасывала бы
+// счётчик раньше времени.
+
+var errDailyLikeLimit = errors.New("daily like limit reached")
+
+// userLocation — часовой пояс юзера, UTC если не задан или некорректный
+func userLocation(ctx context.Context, q dbtx, userID int64) *time.Location {
+	var tz string
+	err := q.QueryRow(ctx, `SELECT "timezone" FROM "Profile" WHERE "userId" = $1`, userID).Scan(&tz)
+	if err != nil {
+		return time.UTC
+	}
+	loc, err := time.LoadLocation(tz)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// localDay возвращает начало текущих локальных суток и следующую полночь
+func localDay(loc *time.Location, now time.Time) (time.Time, time.Time) {
+	local := now.In(loc)
+	start := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, loc)
+	return start, start.AddDate(0, 0, 1)
+}
+
+// consumeDailyLike атомарно засчитывает лайк и возвращает, сколько осталось.
+// Лимит <= 0 (или unlimited_likes в подписке) — без ограничений (возвращает -1).
+func consumeDailyLike(ctx context.Context, q dbtx, userID int64) (int, error) {
+	limit := limitsFor(ctx, userID).likesDaily
+	if limit <= 0 {
+		return -1, nil
+	}
+
+	now := time.Now()
+	day, resetsAt, err := likeWindow(ctx, q, userID, now)
+	if err != nil {
+		return 0, err
+	}
+
+	// строка за ту же дату может остаться от уже закрытого окна
+	// (переезд на запад) — тогда считаем заново
+	var used int
+	err = q.QueryRow(ctx, `
+		INSERT INTO "DailyLikeCount" ("userId","day","likes","resetsAt")
+		VALUES ($1, $2::date, 1, $4)
+		ON CONFLICT ("userId","day") DO UPDATE SET
+			"likes" = CASE WHEN "DailyLikeCount"."resetsAt" <= $5
+				THEN 1 ELSE "DailyLikeCount"."likes" + 1 END,
+			"resetsAt" = CASE WHEN "DailyLikeCount"."resetsAt" <= $5
+				THEN EXCLUDED."resetsAt" ELSE "DailyLikeCount"."resetsAt" END
+		WHERE "DailyLikeCount"."likes" < $3 OR "DailyLikeCount"."resetsAt" <= $5
+		RETURNING "likes"
+	`, userID, day, limit, resetsAt, now).Scan(&used)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, errDailyLikeLimit
+	}
+	if err != nil {
+		return 0, err
+	}
+	return limit - used, nil
+}
+
+// refundDailyLike возвращает лайк, поставленный в likedAt, в дневной лимит (rewind)
+func refundDailyLike(ctx context.Context, q dbtx, userID int64, likedAt time.Time) error {
+	if limitsFor(ctx, userID).likesDaily <= 0 {
+		// без лимита лайки не считались
+		return nil
+	}
+	day, _, err := likeWindow(ctx, q, userID, likedAt)
+	if err != nil {
+		return err
+	}
+	_, err = q.Exec(ctx, `
+		UPDATE "DailyLikeCount"
+		SET "likes" = GREATEST("likes" - 1, 0)
+		WHERE "userId" = $1 AND "day" = $2::date
+	`, userID, day)
+	return err
+}
+
+// likeWindow — сутки лимита лайков, в которые попадает момент t: уже открытые
+// (первая строка с "resetsAt" позже t) или новые по локальной полуночи
+func likeWindow(ctx context.Context, q dbtx, userID int64, t time.Time) (string, time.Time, error) {
+	var day, resetsAt time.Time
+	err := q.QueryRow(ctx, `
+		SELECT "day", "resetsAt"
+		FROM "DailyLikeCount"
+		WHERE "userId" = $1 AND "resetsAt" > $2
+		ORDER BY "resetsAt" ASC
+		LIMIT 1
+	`, userID, t).Scan(&day, &resetsAt)
+	if err == nil {
+		return day.Format("2006-01-02"), resetsAt, nil
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return "", time.Time{}, err
+	}
+	start, end := localDay(userLocation(ctx, q, userID), t)
+	return start.Format("2006-01-02"), end, nil
+}
+
+// ===== слишком быстрые свайпы вправо =====
+
+type swipeGuard struct {
+	mu             sync.Mutex
+	recent         map[int64][]time.Time
+	throttledUntil map[int64]time.Time
+	sweptAt        time.Time
+}
+
+var rightSwipes = &swipeGuard{
+	recent:         make(map[int64][]time.Time),
+	throttledUntil: make(map[int64]time.Time),
+}
+
+// allow засчитывает свайп вправо. Если за SwipeBurstWindow набралось больше
+// SwipeBurstLimit — юзер тормозится на SwipeThrottleCooldown.
+func (g *swipeGuard) allow(userID int64, now time.Time) (time.Duration, bool) {
+	limit := appConfig.SwipeBurstLimit
+	if limit <= 0 {
+		return 0, true
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.sweep(now)
+
+	if until, ok := g.throttledUntil[userID]; ok {
+		if now.Before(until) {
+			return until.Sub(now), false
+		}
+		delete(g.throttledUntil, userID)
+	}
+
+	cutoff := now.Add(-appConfig.SwipeBurstWindow)
+	kept := g.recent[userID][:0]
+	for _, t := range g.recent[userID] {
+		if t.After(cutoff) {
+			kept = append(kept, t)
+		}
+	}
+	kept = append(kept, now)
+
+	if len(kept) > limit {
+		until := now.Add(appConfig.SwipeThrottleCooldown)
+		g.throttledUntil[userID] = until
+		delete(g.recent, userID)
+		log.Printf("swipe guard: user %d sent %d likes in %s, throttled until %s",
+			userID, len(kept), appConfig.SwipeBurstWindow, until.Format(time.RFC3339))
+		return until.Sub(now), false
+	}
+
+	g.recent[userID] = kept
+	return 0, true
+}
+
+// sweep раз в SwipeBurstWindow выкидывает юзеров, которые давно не свайпали,
+// и истёкшие тормоза — иначе карты растут с каждым, кто хоть раз лайкнул.
+// Вызывается под g.mu.
+func (g *swipeGuard) sweep(now time.Time) {
+	window := appConfig.SwipeBurstWindow
+	if now.Sub(g.sweptAt) < window {
+		return
+	}
+	g.sweptAt = now
+
+	cutoff := now.Add(-window)
+	for id, times := range g.recent {
+		if len(times) == 0 || !times[len(times)-1].After(cutoff) {
+			delete(g.recent, id)
+		}
+	}
+	for id, until := range g.throttledUntil {
+		if !now.Before(until) {
+			delete(g.throttledUntil, id)
+		}
+	}
+}
+
+func (g *swipeGuard) throttledUntilFor(userID int64, now time.Time) *time.Time {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	until, ok := g.throttledUntil[userID]
+	if !ok || !now.Before(until) {
+		return nil
+	}
+	return &until
+}
+
+// ===== GET /me/quotas =====
+
+func handleGetMyQuotas(w http.ResponseWriter, r *http.Request) {
+	userID, ok := getUserIDFromContext(r)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "Authentication required")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	now := time.Now()
+	limits := limitsFor(ctx, userID)
+	loc := userLocation(ctx, db, userID)
+	dayStart, dayEnd := localDay(loc, now)
+
+	likeDay, likesResetAt, err := likeWindow(ctx, db, userID, now)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to load like quota")
+		return
+	}
+	var likesUsed int
+	err = db.QueryRow(ctx, `
+		SELECT COALESCE((
+			SELECT "likes" FROM "DailyLikeCount"
+			WHERE "userId" = $1 AND "day" = $2::date AND "resetsAt" > $3
+		), 0)
+	`, userID, likeDay, now).Scan(&likesUsed)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to load like quota")
+		return
+	}
+
+	var superLikes int
+	var refilledAt *time.Time
+	err = db.QueryRow(ctx, `
+		SELECT "superLikes", "superLikesRefilledAt"
+		FROM "Profile"
+		WHERE "userId" = $1
+	`, userID).Scan(&superLikes, &refilledAt)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		writeError(w, http.StatusInternalServerError, "Failed to load super-like quota")
+		return
+	}
+	var nextRefill *time.Time
+	if refilledAt != nil {
+		t := refilledAt.Add(appConfig.SuperLikeRefillInterval)
+		if !t.After(now) {
+			// доливка уже положена — покажем её сразу
+			superLikes = max(superLikes, limits.superLikeRefill)
+			t = now.Add(appConfig.SuperLikeRefillInterval)
+		}
+		nextRefill = &t
+	}
+
+	rewindsUsed, err := rewindsUsedSince(ctx, db, userID, dayStart)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to load rewind quota")
+		return
+	}
+
+	likes := map[string]interface{}{
+		"limit":     nil,
+		"used":      likesUsed,
+		"remaining": nil,
+		"resetsAt":  likesResetAt,
+	}
+	if limit := limits.likesDaily; limit > 0 {
+		likes["limit"] = limit
+		likes["remaining"] = max(limit-likesUsed, 0)
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"timezone": loc.String(),
+		"likes":    likes,
+		"superLikes": map[string]interface{}{
+			"remaining":    superLikes,
+			"refillAmount": limits.superLikeRefill,
+			"nextRefillAt": nextRefill,
+		},
+		"rewinds": map[string]interface{}{
+			"limit":     limits.rewindsDaily,
+			"remaining": max(limits.rewindsDaily-rewindsUsed, 0),
+			"resetsAt":  dayEnd,
+		},
+		"throttledUntil": rightSwipes.throttledUntilFor(userID, now),
+	})
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"math"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// ===== внутренний рейтинг (ELO) =====
+//
+// Каждый входящий лайк/дизлайк — «партия» между оценившим и оценённым:
+// лайк — победа оценённого. Ожидаемый результат зависит от рейтинга
+// оценившего, поэтому лайк от высокого рейтинга даёт больше, а дизлайк
+// от низкого отнимает больше. Рейтинг наружу не отдаётся.
+
+const (
+	ratingInitial = 1000.0
+	ratingScale   = 400.0 // разница, при которой ожидание 1:10
+	ratingKMax    = 40.0  // новые анкеты двигаются быстро
+	ratingKMin    = 10.0
+	// на каком расстоянии по рейтингу бонус за похожесть падает до нуля
+	ratingMatchWindow = 400.0
+)
+
+func ratingExpected(target, rater float64) float64 {
+	return 1 / (1 + math.Pow(10, (rater-target)/ratingScale))
+}
+
+// K убывает с числом оценок: сначала рейтинг быстро находит своё место
+func ratingK(votes int) float64 {
+	return math.Max(ratingKMin, ratingKMax-float64(votes)/2)
+}
+
+// recordRatingVote обновляет рейтинг targetID после оценки от raterID
+func recordRatingVote(ctx context.Context, q dbtx, raterID, targetID int64, liked bool) error {
+	_, err := q.Exec(ctx, `
+		INSERT INTO "UserRating" ("userId")
+		VALUES (LEAST($1::bigint, $2::bigint)), (GREATEST($1::bigint, $2::bigint))
+		ON CONFLICT ("userId") DO NOTHING
+	`, raterID, targetID)
+	if err != nil {
+		return err
+	}
+
+	var raterRating float64
+	err = q.QueryRow(ctx, `SELECT "rating" FROM "UserRating" WHERE "userId" = $1`, raterID).Scan(&raterRating)
+	if err != nil {
+		return err
+	}
+
+	var rating float64
+	var votes int
+	err = q.QueryRow(ctx, `
+		SELECT "rating", "votes"
+		FROM "UserRating"
+		WHERE "userId" = $1
+		FOR UPDATE
+	`, targetID).Scan(&rating, &votes)
+	if err != nil {
+		return err
+	}
+
+	score := 0.0
+	if liked {
+		score = 1
+	}
+	delta := ratingK(votes) * (score - ratingExpected(rating, raterRating))
+
+	_, err = q.Exec(ctx, `
+		UPDATE "UserRating"
+		SET "rating" = "rating" + $2, "votes" = "votes" + 1, "updatedAt" = NOW()
+		WHERE "userId" = $1
+	`, targetID, delta)
+	if err != nil {
+		return err
+	}
+
+	// последняя оценка пары — чтобы rewind мог её откатить
+	_, err = q.Exec(ctx, `
+		INSERT INTO "RatingVote" ("raterId","targetId","delta")
+		VALUES ($1, $2, $3)
+		ON CONFLICT ("raterId","targetId") DO UPDATE SET
+			"delta" = EXCLUDED."delta",
+			"createdAt" = NOW()
+	`, raterID, targetID, delta)
+	return err
+}
+
+// revertRatingVote откатывает последнюю оценку raterID для targetID (rewind).
+// Вычитается ровно та дельта, что была добавлена; оценки, пришедшие после,
+// не пересчитываются.
+func revertRatingVote(ctx context.Context, q dbtx, raterID, targetID int64) error {
+	var delta float64
+	err := q.QueryRow(ctx, `
+		DELETE FROM "RatingVote"
+		WHERE "raterId" = $1 AND "targetId" = $2
+		RETURNING "delta"
+	`, raterID, targetID).Scan(&delta)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	_, err = q.Exec(ctx, `
+		UPDATE "UserRating"
+		SET "rating" = "rating" - $2, "votes" = GREATEST("votes" - 1, 0), "updatedAt" = NOW()
+		WHERE "userId" = $1
+	`, targetID, delta)
+	return err
+}
+
+// бонус за близкий рейтинг: 1 при равных, 0 на расстоянии ratingMatchWindow
+func ratingCloseness(a, b float64) float64 {
+	return math.Max(0, 1-math.Abs(a-b)/ratingMatchWindow)
+}
+
+// ===== ограничение показов =====
+//
+// Если кандидата за сутки (UTC) показали больше ExposureDailyCap раз, он
+// уходит вниз выдачи, чтобы несколько популярных анкет не занимали все ленты.
+// Суперлайк (1000) всё равно перевешивает штраф.
+
+const scoreOverExposed = -200.0
+
+var exposureCapComponent = scoreComponent{
+	Kind:   "exposure",
+	Label:  "shown a lot today",
+	Points: scoreOverExposed,
+}
+
+// applyExposureCaps штрафует кандидатов, исчерпавших дневной лимит показов,
+// и пересортировывает
+func applyExposureCaps(ctx context.Context, results []scoredCandidate) (map[int64]bool, error) {
+	capped := map[int64]bool{}
+	limit := appConfig.ExposureDailyCap
+	if limit <= 0 || len(results) == 0 {
+		return capped, nil
+	}
+
+	ids := make([]int64, 0, len(results))
+	for _, c := range results {
+		ids = append(ids, c.id)
+	}
+	rows, err := db.Query(ctx, `
+		SELECT "userId"
+		FROM "ExposureCount"
+		WHERE "userId" = ANY($1)
+		  AND "day" = $2::date
+		  AND "impressions" >= $3
+	`, ids, time.Now().UTC().Format("2006-01-02"), limit)
+	if err != nil {
+		return nil, err
+	}
+	cappedIDs, err := pgx.CollectRows(rows, pgx.RowTo[int64])
+	if err != nil {
+		return nil, err
+	}
+	if len(cappedIDs) == 0 {
+		return capped, nil
+	}
+
+	for _, id := range cappedIDs {
+		capped[id] = true
+	}
+	for i := range results {
+		if capped[results[i].id] {
+			results[i].score += scoreOverExposed
+			if results[i].components != nil {
+				results[i].components = append(results[i].components, exposureCapComponent)
+			}
+		}
+	}
+	sortScoredCandidates(results)
+	return capped, nil
+}
+
+// recordExposure засчитывает показ карточек в дневной счётчик
+func recordExposure(ctx context.Context, shownIDs []int64) {
+	if len(shownIDs) == 0 {
+		return
+	}
+	_, err := db.Exec(ctx, `
+		INSERT INTO "ExposureCount" ("userId","day","impressions")
+		SELECT id, $2::date, 1
+		FROM UNNEST($1::bigint[]) AS id
+		ON CONFLICT ("userId","day") DO UPDATE SET
+			"impressions" = "ExposureCount"."impressions" + 1
+	`, shownIDs, time.Now().UTC().Format("2006-01-02"))
+	if err != nil {
+		log.Printf("recordExposure: %v", err)
+	}
+}
@@ -2,10 +2,14 @@ package main
 
 import (
 	"context"
+	"errors"
 	"math"
 	"net/http"
 	"sort"
+	"strconv"
 	"time"
+
+	"github.com/jackc/pgx/v5"
 )
 
 // простая функция для возраста
@@ -35,163 +39,361 @@ func distanceKm(lat1, lon1, lat2, lon2 float64) float64 {
 	return R * c
 }
 
-func handleGetRecommendations(w http.ResponseWriter, r *http.Request) {
-	userID, ok := getUserIDFromContext(r)
-	if !ok {
-		writeError(w, http.StatusUnauthorized, "Authentication required")
-		return
-	}
+var errProfileIncomplete = errors.New("profile is not complete for recommendations")
 
-	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
-	defer cancel()
+// данные текущего юзера, нужные для подбора
+type recViewer struct {
+	recProfile
+	prefSex                   *string
+	ageMin, ageMax, maxDistKm *int
+}
+
+type scoredCandidate struct {
+	id         int64
+	score      float64
+	components []scoreComponent
+}
 
-	// тянем текущего юзера с профилем/префами/био
-	var (
-		name                      string
-		dateOfBirth               time.Time
-		sex                       string
-		myLat, myLon              *float64
-		myPrefSex                 *string
-		ageMin, ageMax, maxDistKm *int
-	)
+func loadRecViewer(ctx context.Context, userID int64) (*recViewer, error) {
+	v := recViewer{recProfile: recProfile{id: userID}}
+	var likesGiven int
+	var terms map[string]int
 	err := db.QueryRow(ctx, `
-		SELECT u."name", u."dateOfBirth", u."sex",
+		SELECT u."dateOfBirth", u."sex",
 		       p."latitude", p."longitude",
-		       pr."preferredSex", pr."ageMin", pr."ageMax", pr."maxDistanceKm"
+		       pr."preferredSex", pr."ageMin", pr."ageMax", pr."maxDistanceKm",
+		       COALESCE(b."hobbies", '{}'), COALESCE(b."languages", '{}'), b."goals",
+		       bt."terms", COALESCE(ur."rating", $2),
+		       (
+				SELECT COUNT(*)
+				FROM "ConnectionSide" cs
+				WHERE cs."userId" = u."id"
+				  AND cs."action" IN ('LIKED','SUPERLIKED')
+		       )
 		FROM "User" u
 		LEFT JOIN "Profile" p ON p."userId" = u."id"
 		LEFT JOIN "Preferences" pr ON pr."userId" = u."id"
 		LEFT JOIN "Bio" b ON b."userId" = u."id"
+		LEFT JOIN "BioTerms" bt ON bt."userId" = u."id"
+		LEFT JOIN "UserRating" ur ON ur."userId" = u."id"
 		WHERE u."id" = $1
-	`, userID).Scan(&name, &dateOfBirth, &sex, &myLat, &myLon, &myPrefSex, &ageMin, &ageMax, &maxDistKm)
-	if err != nil || myPrefSex == nil {
-		writeError(w, http.StatusBadRequest, "Profile is not complete for recommendations")
-		return
+	`, userID, ratingInitial).Scan(&v.dateOfBirth, &v.sex, &v.lat, &v.lon,
+		&v.prefSex, &v.ageMin, &v.ageMax, &v.maxDistKm,
+		&v.hobbies, &v.languages, &v.goals, &terms, &v.rating, &likesGiven)
+	if errors.Is(err, pgx.ErrNoRows) || (err == nil && v.prefSex == nil) {
+		return nil, errProfileIncomplete
 	}
-
-	now := time.Now()
-	myAge := calcAge(dateOfBirth, now)
-
-	// собираем id пользователей, с которыми уже есть коннекшены/матчи
-	blocked := map[int64]bool{}
-	rows, err := db.Query(ctx, `
-		SELECT "toUserId"
-		FROM "Connection"
-		WHERE "fromUserId" = $1
-		  AND "status" IN ('LIKED','SUPERLIKED','DISLIKED','MATCHED')
-	`, userID)
-	if err == nil {
-		defer rows.Close()
-		for rows.Next() {
-			var id int64
-			if err := rows.Scan(&id); err == nil {
-				blocked[id] = true
-			}
-		}
-	}
-
-	rows2, err := db.Query(ctx, `
-		SELECT "fromUserId","toUserId"
-		FROM "Connection"
-		WHERE "status" = 'MATCHED'
-		  AND ("fromUserId" = $1 OR "toUserId" = $1)
-	`, userID)
-	if err == nil {
-		defer rows2.Close()
-		for rows2.Next() {
-			var fromID, toID int64
-			if err := rows2.Scan(&fromID, &toID); err == nil {
-				if fromID == userID {
-					blocked[toID] = true
-				} else {
-					blocked[fromID] = true
-				}
-			}
-		}
+	if err != nil {
+		return nil, err
 	}
+	// коллаборативную оценку подмешиваем, только когда данных достаточно
+	v.useAffinity = likesGiven >= appConfig.AffinityMinLikes
+	v.textVec = bioTextIndex.vector(terms)
+	return &v, nil
+}
 
-	// кандидаты
-	candRows, err := db.Query(ctx, `
+// loadRecCandidates тянет анкеты кандидатов; ids == nil — все полные анкеты
+func loadRecCandidates(ctx context.Context, viewerID int64, ids []int64) ([]recProfile, error) {
+	rows, err := db.Query(ctx, `
 		SELECT u."id", u."dateOfBirth", u."sex",
-		       p."latitude", p."longitude"
+		       p."latitude", p."longitude",
+		       b."hobbies", b."languages", b."goals",
+		       EXISTS (
+				SELECT 1 FROM "ConnectionSide" sl
+				WHERE sl."userId" = $1
+				  AND sl."otherUserId" = u."id"
+				  AND sl."otherAction" = 'SUPERLIKED'
+		       ) AS "superLikedViewer",
+		       COALESCE(ca."score", 0),
+		       bt."terms",
+		       COALESCE(ur."rating", $3)
 		FROM "User" u
 		INNER JOIN "Profile" p ON p."userId" = u."id"
 		INNER JOIN "Preferences" pr ON pr."userId" = u."id"
 		INNER JOIN "Bio" b ON b."userId" = u."id"
+		LEFT JOIN "CandidateAffinity" ca ON ca."userId" = $1 AND ca."candidateId" = u."id"
+		LEFT JOIN "BioTerms" bt ON bt."userId" = u."id"
+		LEFT JOIN "UserRating" ur ON ur."userId" = u."id"
 		WHERE u."id" <> $1
-	`, userID)
+		  AND ($2::bigint[] IS NULL OR u."id" = ANY($2))
+		  AND u."bannedAt" IS NULL
+		  AND (u."suspendedUntil" IS NULL OR u."suspendedUntil" < NOW())
+	`, viewerID, ids, ratingInitial)
 	if err != nil {
-		writeError(w, http.StatusInternalServerError, "Failed to load candidates")
-		return
+		return nil, err
 	}
-	defer candRows.Close()
+	defer rows.Close()
 
-	type scored struct {
-		id    int64
-		score float64
+	var out []recProfile
+	for rows.Next() {
+		var c recProfile
+		var terms map[string]int
+		if err := rows.Scan(&c.id, &c.dateOfBirth, &c.sex, &c.lat, &c.lon,
+			&c.hobbies, &c.languages, &c.goals, &c.superLikedViewer, &c.affinity, &terms, &c.rating); err != nil {
+			return nil, err
+		}
+		c.textVec = bioTextIndex.vector(terms)
+		out = append(out, c)
 	}
-	var results []scored
-
-	for candRows.Next() {
-		var cid int64
-		var dob2 time.Time
-		var sex2 string
-		var lat2, lon2 *float64
+	return out, rows.Err()
+}
 
-		if err := candRows.Scan(&cid, &dob2, &sex2, &lat2, &lon2); err != nil {
-			continue
+// id пользователей, с которыми уже есть коннекшены/матчи или блок.
+// Пропущенные (DISLIKED) возвращаются после DislikeCooldown, если заметно
+// поменяли анкету и зритель не отключил это (см. resurfacing.go).
+func excludedCandidateIDs(ctx context.Context, userID int64) (map[int64]bool, error) {
+	excluded := map[int64]bool{}
+	rows, err := db.Query(ctx, `
+		SELECT cs."otherUserId"
+		FROM "ConnectionSide" cs
+		INNER JOIN "User" t ON t."id" = cs."otherUserId"
+		WHERE cs."userId" = $1
+		  AND (
+			cs."matchedAt" IS NOT NULL
+			OR cs."action" IN ('LIKED','SUPERLIKED')
+			OR (cs."action" = 'DISLIKED' AND NOT (
+				$2::float8 > 0
+				AND COALESCE((SELECT "resurfacePassed" FROM "Preferences" WHERE "userId" = $1), TRUE)
+				AND cs."actedAt" < NOW() - make_interval(secs => $2)
+				AND t."profileChangedAt" > cs."actedAt"
+			))
+		  )
+		UNION
+		SELECT "blockedId" FROM "Block" WHERE "blockerId" = $1
+		UNION
+		SELECT "blockerId" FROM "Block" WHERE "blockedId" = $1
+	`, userID, appConfig.DislikeCooldown.Seconds())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
 		}
-		if blocked[cid] {
-			continue
+		excluded[id] = true
+	}
+	return excluded, rows.Err()
+}
+
+// простые фильтры по возрасту, полу и расстоянию
+func matchesPreferences(me *recViewer, c *recProfile, now time.Time) bool {
+	age2 := calcAge(c.dateOfBirth, now)
+	if me.ageMin != nil && age2 < *me.ageMin {
+		return false
+	}
+	if me.ageMax != nil && age2 > *me.ageMax {
+		return false
+	}
+	if me.prefSex != nil && *me.prefSex != "ALL" && c.sex != *me.prefSex {
+		return false
+	}
+	if me.lat != nil && me.lon != nil && c.lat != nil && c.lon != nil && me.maxDistKm != nil {
+		d := distanceKm(*me.lat, *me.lon, *c.lat, *c.lon)
+		if d > float64(*me.maxDistKm) {
+			return false
 		}
+	}
+	return true
+}
 
-		age2 := calcAge(dob2, now)
+// computeRecommendations считает и сортирует всех подходящих кандидатов
+func computeRecommendations(ctx context.Context, userID int64) ([]scoredCandidate, error) {
+	me, err := loadRecViewer(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
 
-		// простые фильтры по возрасту и полу
-		if ageMin != nil && age2 < *ageMin {
-			continue
-		}
-		if ageMax != nil && age2 > *ageMax {
-			continue
-		}
-		if myPrefSex != nil && *myPrefSex != "ALL" && sex2 != *myPrefSex {
+	excluded, err := excludedCandidateIDs(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	candidates, err := loadRecCandidates(ctx, userID, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	weights := scorerForUser(userID)
+	var results []scoredCandidate
+	for i := range candidates {
+		c := &candidates[i]
+		if excluded[c.id] || !matchesPreferences(me, c, now) {
 			continue
 		}
+		score, components := scoreCandidate(&me.recProfile, c, now, weights)
+		results = append(results, scoredCandidate{id: c.id, score: score, components: components})
+	}
 
-		// расстояние
-		if myLat != nil && myLon != nil && lat2 != nil && lon2 != nil && maxDistKm != nil {
-			d := distanceKm(*myLat, *myLon, *lat2, *lon2)
-			if d > float64(*maxDistKm) {
-				continue
-			}
-		}
+	sortScoredCandidates(results)
+	return results, nil
+}
 
-		// скромный скоринг: чем ближе возраст, тем выше
-		ageGap := math.Abs(float64(myAge - age2))
-		score := 100.0 - ageGap
+// explainCandidates заново считает разбивку скоринга для уже выбранных id
+// (в очереди хранится только итоговый score)
+func explainCandidates(ctx context.Context, userID int64, ids []int64) (map[int64][]scoreComponent, error) {
+	out := make(map[int64][]scoreComponent, len(ids))
+	if len(ids) == 0 {
+		return out, nil
+	}
+
+	me, err := loadRecViewer(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	candidates, err := loadRecCandidates(ctx, userID, ids)
+	if err != nil {
+		return nil, err
+	}
 
-		results = append(results, scored{id: cid, score: score})
+	now := time.Now()
+	weights := scorerForUser(userID)
+	for i := range candidates {
+		_, components := scoreCandidate(&me.recProfile, &candidates[i], now, weights)
+		out[candidates[i].id] = components
 	}
+	return out, nil
+}
 
-	// сортируем по score
+func sortScoredCandidates(results []scoredCandidate) {
 	sort.Slice(results, func(i, j int) bool {
 		if results[i].score == results[j].score {
 			return results[i].id < results[j].id
 		}
 		return results[i].score > results[j].score
 	})
+}
+
+const recommendationsPageSize = 10
+
+type recommendationExplanation struct {
+	UserID     int64            `json:"userId"`
+	Score      float64          `json:"score"`
+	Components []scoreComponent `json:"components"`
+}
+
+// GET /recommendations[?explain=true]
+func handleGetRecommendations(w http.ResponseWriter, r *http.Request) {
+	userID, ok := getUserIDFromContext(r)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "Authentication required")
+		return
+	}
+
+	explain, _ := strconv.ParseBool(r.URL.Query().Get("explain"))
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	// сначала пробуем готовую очередь
+	queue, err := readRecommendationQueue(ctx, userID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to load recommendation queue")
+		return
+	}
+
+	results := queue.candidates
+	source := "queue"
+	if len(results) == 0 {
+		// очередь пустая — считаем на лету, воркер её потом заполнит
+		source = "live"
+		results, err = computeRecommendations(ctx, userID)
+		if errors.Is(err, errProfileIncomplete) {
+			writeError(w, http.StatusBadRequest, "Profile is not complete for recommendations")
+			return
+		}
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "Failed to load candidates")
+			return
+		}
+		markRecommendationsStale(ctx, userID)
+	}
+
+	// активные бусты поднимают кандидатов (поверх сохранённого score)
+	boosted, err := applyActiveBoosts(ctx, results)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to load boosts")
+		return
+	}
+
+	// слишком часто показанные сегодня — вниз
+	capped, err := applyExposureCaps(ctx, results)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to load exposure counts")
+		return
+	}
+
+	// отменённые через rewind — снова наверх
+	results, err = pinRewoundCandidates(ctx, userID, results)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to load rewound candidates")
+		return
+	}
 
 	// берём топ-10
-	limit := 10
+	limit := recommendationsPageSize
 	if len(results) < limit {
 		limit = len(results)
 	}
+	results = results[:limit]
 	ids := make([]int64, 0, limit)
-	for i := 0; i < limit; i++ {
-		ids = append(ids, results[i].id)
+	for _, c := range results {
+		ids = append(ids, c.id)
 	}
 
-	writeJSON(w, http.StatusOK, map[string]interface{}{
+	// показы для аналитики бустов
+	recordBoostImpressions(ctx, ids)
+	recordExposure(ctx, ids)
+
+	// разбивка скоринга нужна и для explain, и для лога показов
+	byID, err := explainCandidates(ctx, userID, ids)
+	if err != nil {
+		if explain {
+			writeError(w, http.StatusInternalServerError, "Failed to explain recommendations")
+			return
+		}
+		byID = map[int64][]scoreComponent{}
+	}
+
+	explanations := make([]recommendationExplanation, 0, len(results))
+	for i, c := range results {
+		components := byID[c.id]
+		if boosted[c.id] {
+			components = append(components, boostComponent)
+		}
+		if capped[c.id] {
+			components = append(components, exposureCapComponent)
+		}
+		if components == nil {
+			components = []scoreComponent{}
+		}
+		explanations = append(explanations, recommendationExplanation{
+			UserID:     c.id,
+			Score:      c.score,
+			Components: components,
+		})
+
+		pos := i
+		logRecEvent(recEvent{
+			UserID:      userID,
+			CandidateID: c.id,
+			Type:        "IMPRESSION",
+			Score:       &results[i].score,
+			Components:  components,
+			Source:      source,
+			Position:    &pos,
+		})
+	}
+
+	resp := map[string]interface{}{
 		"recommendations": ids,
-	})
+		"queue":           queue.freshness(source),
+	}
+	if explain {
+		resp["explanations"] = explanations
+	}
+
+	writeJSON(w, http.StatusOK, resp)
 }
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// ===== очередь рекомендаций =====
+//
+// Воркер заранее считает отсортированных кандидатов для каждого юзера и
+// кладёт их в "RecommendationQueue". /recommendations читает оттуда, а если
+// очередь пустая — считает на лету.
+
+type recommendationQueue struct {
+	candidates []scoredCandidate
+	computedAt *time.Time
+	stale      bool
+	size       int
+}
+
+type queueFreshness struct {
+	Source     string     `json:"source"` // queue / live
+	ComputedAt *time.Time `json:"computedAt"`
+	AgeSeconds *int64     `json:"ageSeconds"`
+	Stale      bool       `json:"stale"`
+	Size       int        `json:"size"`
+	Remaining  int        `json:"remaining"`
+}
+
+func (q recommendationQueue) freshness(source string) queueFreshness {
+	f := queueFreshness{
+		Source:     source,
+		ComputedAt: q.computedAt,
+		Stale:      q.stale,
+		Size:       q.size,
+		Remaining:  len(q.candidates),
+	}
+	if q.computedAt != nil {
+		age := int64(time.Since(*q.computedAt).Seconds())
+		f.AgeSeconds = &age
+	}
+	return f
+}
+
+// readRecommendationQueue отдаёт кандидатов из очереди, выкидывая тех,
+// с кем коннекшен появился уже после пересчёта, и забаненных или
+// замороженных модерацией за это время
+func readRecommendationQueue(ctx context.Context, userID int64) (recommendationQueue, error) {
+	var q recommendationQueue
+
+	err := db.QueryRow(ctx, `
+		SELECT "computedAt", "stale"
+		FROM "RecommendationQueueState"
+		WHERE "userId" = $1
+	`, userID).Scan(&q.computedAt, &q.stale)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return q, nil
+	}
+	if err != nil {
+		return q, err
+	}
+
+	excluded, err := excludedCandidateIDs(ctx, userID)
+	if err != nil {
+		return q, err
+	}
+
+	rows, err := db.Query(ctx, `
+		SELECT q."candidateId", q."score"
+		FROM "RecommendationQueue" q
+		INNER JOIN "User" u ON u."id" = q."candidateId"
+		WHERE q."userId" = $1
+		  AND u."bannedAt" IS NULL
+		  AND (u."suspendedUntil" IS NULL OR u."suspendedUntil" < NOW())
+		ORDER BY q."position" ASC
+	`, userID)
+	if err != nil {
+		return q, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var c scoredCandidate
+		if err := rows.Scan(&c.id, &c.score); err != nil {
+			return q, err
+		}
+		q.size++
+		if excluded[c.id] {
+			continue
+		}
+		q.candidates = append(q.candidates, c)
+	}
+	return q, rows.Err()
+}
+
+// markRecommendationsStale просит воркер пересчитать очереди этих юзеров
+func markRecommendationsStale(ctx context.Context, userIDs ...int64) {
+	for _, id := range userIDs {
+		_, err := db.Exec(ctx, `
+			INSERT INTO "RecommendationQueueState" ("userId","stale","staleSince")
+			VALUES ($1, TRUE, NOW())
+			ON CONFLICT ("userId") DO UPDATE SET
+				"stale" = TRUE,
+				"staleSince" = NOW()
+		`, id)
+		if err != nil {
+			log.Printf("markRecommendationsStale(%d): %v", id, err)
+		}
+	}
+}
+
+// markCandidateQueuesStale — юзер поменял анкету или предпочтения: пересчитать
+// его собственную очередь и все чужие, где он уже лежит кандидатом
+func markCandidateQueuesStale(ctx context.Context, userID int64) {
+	markRecommendationsStale(ctx, userID)
+	_, err := db.Exec(ctx, `
+		INSERT INTO "RecommendationQueueState" ("userId","stale","staleSince")
+		SELECT DISTINCT q."userId", TRUE, NOW()
+		FROM "RecommendationQueue" q
+		WHERE q."candidateId" = $1
+		ON CONFLICT ("userId") DO UPDATE SET
+			"stale" = TRUE,
+			"staleSince" = NOW()
+	`, userID)
+	if err != nil {
+		log.Printf("markCandidateQueuesStale(%d): %v", userID, err)
+	}
+}
+
+// refreshRecommendationQueue пересчитывает очередь одного юзера
+func refreshRecommendationQueue(ctx context.Context, userID int64, size int) error {
+	startedAt := time.Now()
+	results, err := computeRecommendations(ctx, userID)
+	if err != nil && !errors.Is(err, errProfileIncomplete) {
+		return err
+	}
+	if len(results) > size {
+		results = results[:size]
+	}
+
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, `DELETE FROM "RecommendationQueue" WHERE "userId" = $1`, userID); err != nil {
+		return err
+	}
+
+	if len(results) > 0 {
+		rows := make([][]any, 0, len(results))
+		for i, c := range results {
+			rows = append(rows, []any{userID, c.id, i, c.score})
+		}
+		_, err = tx.CopyFrom(ctx,
+			pgx.Identifier{"RecommendationQueue"},
+			[]string{"userId", "candidateId", "position", "score"},
+			pgx.CopyFromRows(rows),
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	// если юзера пометили stale, пока мы считали, — флаг оставляем
+	_, err = tx.Exec(ctx, `
+		INSERT INTO "RecommendationQueueState" ("userId","stale","computedAt","staleSince")
+		VALUES ($1, FALSE, NOW(), NULL)
+		ON CONFLICT ("userId") DO UPDATE SET
+			"stale" = COALESCE("RecommendationQueueState"."staleSince" > $2, FALSE),
+			"computedAt" = NOW(),
+			"staleSince" = CASE
+				WHEN "RecommendationQueueState"."staleSince" > $2 THEN "RecommendationQueueState"."staleSince"
+			END
+	`, userID, startedAt)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// ===== фоновый воркер =====
+
+const recsWorkerBatch = 50
+
+func runRecommendationWorker(ctx context.Context, cfg Config) {
+	ticker := time.NewTicker(cfg.RecsWorkerInterval)
+	defer ticker.Stop()
+
+	for {
+		refreshBioTextIndex(ctx)
+		refreshDueRecommendationQueues(ctx, cfg)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// сначала помеченные stale, потом те, у кого очередь старше RecsRefreshInterval
+func refreshDueRecommendationQueues(ctx context.Context, cfg Config) {
+	qctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	rows, err := db.Query(qctx, `
+		SELECT u."id"
+		FROM "User" u
+		INNER JOIN "Preferences" pr ON pr."userId" = u."id"
+		LEFT JOIN "RecommendationQueueState" s ON s."userId" = u."id"
+		WHERE s."userId" IS NULL
+		   OR s."stale"
+		   OR s."computedAt" IS NULL
+		   OR s."computedAt" < NOW() - make_interval(secs => $1)
+		ORDER BY s."stale" DESC NULLS FIRST, s."computedAt" ASC NULLS FIRST
+		LIMIT $2
+	`, cfg.RecsRefreshInterval.Seconds(), recsWorkerBatch)
+	if err != nil {
+		cancel()
+		log.Printf("recommendation worker: load due users: %v", err)
+		return
+	}
+	ids, err := pgx.CollectRows(rows, pgx.RowTo[int64])
+	cancel()
+	if err != nil {
+		log.Printf("recommendation worker: scan due users: %v", err)
+		return
+	}
+
+	start := time.Now()
+	refreshed := 0
+	for _, id := range ids {
+		if ctx.Err() != nil {
+			return
+		}
+		rctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+		err := refreshRecommendationQueue(rctx, id, cfg.RecsQueueSize)
+		cancel()
+		if err != nil {
+			log.Printf("recommendation worker: refresh user %d: %v", id, err)
+			continue
+		}
+		refreshed++
+	}
+	if refreshed > 0 {
+		log.Printf("recommendation worker: refreshed %d queues in %s", refreshed, time.Since(start).Round(time.Millisecond))
+	}
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+// анкета, по которой считается скоринг (и у зрителя, и у кандидата)
+type recProfile struct {
+	id          int64
+	dateOfBirth time.Time
+	sex         string
+	lat, lon    *float64
+	hobbies     []string
+	languages   []string
+	goals       *string
+
+	// кандидат уже суперлайкнул зрителя
+	superLikedViewer bool
+	// оценка из cmd/affinity (0..1) для этого зрителя
+	affinity float64
+	// у зрителя достаточно лайков, чтобы подмешивать affinity
+	useAffinity bool
+	// внутренний ELO рейтинг (см. rating.go)
+	rating float64
+	// нормированный TF-IDF вектор aboutMe + goals (см. textsim.go)
+	textVec map[string]float64
+}
+
+// одна составляющая скоринга — то, что показываем в "почему вы видите этого человека"
+type scoreComponent struct {
+	Kind   string  `json:"kind"` // age / hobbies / languages / goal / text / rating / distance / affinity / superlike
+	Label  string  `json:"label"`
+	Points float64 `json:"points"`
+}
+
+// веса одной стратегии скоринга
+type scorerWeights struct {
+	AgeBase       float64
+	AgeGap        float64 // минус за каждый год разницы
+	PerHobby      float64
+	PerLanguage   float64
+	SameGoal      float64
+	DistanceMax   float64
+	DistancePerKm float64
+	Affinity      float64 // множитель для оценки коллаборативной фильтрации
+	Text          float64 // множитель для косинусной похожести текста анкеты
+	Rating        float64 // бонус за близкий рейтинг
+}
+
+const defaultScorer = "default"
+
+// стратегии, между которыми можно делить юзеров в экспериментах
+var scorers = map[string]scorerWeights{
+	// 100 - разница в возрасте плюс сигналы affinity, текста и рейтинга;
+	// хобби, языки, цель и расстояние только объясняются и очков не дают
+	defaultScorer: {
+		AgeBase: 100, AgeGap: 1,
+		Affinity: 30, Text: 25, Rating: 20,
+	},
+	// только возраст — исходная формула без дополнительных сигналов
+	"age_only": {
+		AgeBase: 100, AgeGap: 1,
+	},
+	// default + очки за общие хобби, языки, цель и близость
+	"profile_match": {
+		AgeBase: 100, AgeGap: 1,
+		PerHobby: 5, PerLanguage: 3, SameGoal: 10,
+		DistanceMax: 10, DistancePerKm: 0.2,
+		Affinity: 30, Text: 25, Rating: 20,
+	},
+	// упор на общие интересы и цель
+	"interests": {
+		AgeBase: 100, AgeGap: 0.5,
+		PerHobby: 12, PerLanguage: 6, SameGoal: 20,
+		DistanceMax: 5, DistancePerKm: 0.1,
+		Affinity: 30, Text: 40, Rating: 10,
+	},
+	// упор на близость
+	"nearby": {
+		AgeBase: 100, AgeGap: 1,
+		PerHobby: 3, PerLanguage: 2, SameGoal: 5,
+		DistanceMax: 40, DistancePerKm: 0.8,
+		Affinity: 15, Text: 10, Rating: 10,
+	},
+}
+
+func scorerByName(name string) scorerWeights {
+	if w, ok := scorers[name]; ok {
+		return w
+	}
+	return scorers[defaultScorer]
+}
+
+const (
+	scoreMaxListedItems = 3
+
+	// входящий суперлайк всегда выше любого обычного скоринга
+	scoreSuperLikedYou = 1000.0
+)
+
+// scoreCandidate возвращает итоговый score и его разбивку по составляющим.
+// Хобби, языки, цель и расстояние попадают в разбивку всегда — как объяснение;
+// очки за них дают только стратегии с ненулевыми весами
+func scoreCandidate(me, c *recProfile, now time.Time, w scorerWeights) (float64, []scoreComponent) {
+	var components []scoreComponent
+
+	// чем ближе возраст, тем выше
+	ageGap := math.Abs(float64(calcAge(me.dateOfBirth, now) - calcAge(c.dateOfBirth, now)))
+	ageLabel := "same age"
+	if ageGap == 1 {
+		ageLabel = "1 year age difference"
+	} else if ageGap > 1 {
+		ageLabel = fmt.Sprintf("%d years age difference", int(ageGap))
+	}
+	components = append(components, scoreComponent{
+		Kind:   "age",
+		Label:  ageLabel,
+		Points: w.AgeBase - w.AgeGap*ageGap,
+	})
+
+	if shared := intersectFold(me.hobbies, c.hobbies); len(shared) > 0 {
+		label := "1 shared hobby"
+		if len(shared) > 1 {
+			label = fmt.Sprintf("%d shared hobbies", len(shared))
+		}
+		components = append(components, scoreComponent{
+			Kind:   "hobbies",
+			Label:  label + ": " + listPreview(shared),
+			Points: w.PerHobby * float64(len(shared)),
+		})
+	}
+
+	if shared := intersectFold(me.languages, c.languages); len(shared) > 0 {
+		components = append(components, scoreComponent{
+			Kind:   "languages",
+			Label:  "speaks " + listPreview(shared),
+			Points: w.PerLanguage * float64(len(shared)),
+		})
+	}
+
+	if me.goals != nil && c.goals != nil && *me.goals != "" &&
+		strings.EqualFold(strings.TrimSpace(*me.goals), strings.TrimSpace(*c.goals)) {
+		components = append(components, scoreComponent{
+			Kind:   "goal",
+			Label:  "same goal: " + strings.ToLower(strings.TrimSpace(*c.goals)),
+			Points: w.SameGoal,
+		})
+	}
+
+	if w.Text != 0 && me.textVec != nil && c.textVec != nil {
+		if sim, shared := textSimilarity(me.textVec, c.textVec); sim >= textMinSimilarity {
+			components = append(components, scoreComponent{
+				Kind:   "text",
+				Label:  "similar bio: " + listPreview(shared[:min(len(shared), scoreMaxListedItems)]),
+				Points: w.Text * sim,
+			})
+		}
+	}
+
+	// рейтинг не показываем, метка говорит только о вероятной взаимности
+	if w.Rating != 0 {
+		if closeness := ratingCloseness(me.rating, c.rating); closeness > 0 {
+			components = append(components, scoreComponent{
+				Kind:   "rating",
+				Label:  "likely mutual interest",
+				Points: w.Rating * closeness,
+			})
+		}
+	}
+
+	// расстояние считаем только по округлённому значению,
+	// чтобы ни метка, ни очки не выдавали точные координаты кандидата
+	if me.lat != nil && me.lon != nil && c.lat != nil && c.lon != nil {
+		km := coarseDistanceKm(distanceKm(*me.lat, *me.lon, *c.lat, *c.lon))
+		points := math.Max(0, w.DistanceMax-km*w.DistancePerKm)
+		components = append(components, scoreComponent{
+			Kind:   "distance",
+			Label:  distanceLabel(km),
+			Points: points,
+		})
+	}
+
+	if me.useAffinity && c.affinity > 0 && w.Affinity != 0 {
+		components = append(components, scoreComponent{
+			Kind:   "affinity",
+			Label:  "liked by people with similar taste",
+			Points: w.Affinity * c.affinity,
+		})
+	}
+
+	if c.superLikedViewer {
+		components = append(components, scoreComponent{
+			Kind:   "superlike",
+			Label:  "super-liked you",
+			Points: scoreSuperLikedYou,
+		})
+	}
+
+	total := 0.0
+	for _, comp := range components {
+		total += comp.Points
+	}
+	return total, components
+}
+
+// coarseDistanceKm округляет расстояние: до 10 км — до километра,
+// до 50 — до 5 км, дальше — до 10 км
+func coarseDistanceKm(d float64) float64 {
+	switch {
+	case d < 1:
+		return 0
+	case d < 10:
+		return math.Round(d)
+	case d < 50:
+		return math.Round(d/5) * 5
+	default:
+		return math.Round(d/10) * 10
+	}
+}
+
+func distanceLabel(km float64) string {
+	if km < 1 {
+		return "less than 1 km away"
+	}
+	return fmt.Sprintf("%d km away", int(km))
+}
+
+// общие элементы двух списков без учёта регистра, в порядке первого
+func intersectFold(a, b []string) []string {
+	seen := make(map[string]bool, len(b))
+	for _, v := range b {
+		seen[strings.ToLower(strings.TrimSpace(v))] = true
+	}
+	var out []string
+	for _, v := range a {
+		key := strings.ToLower(strings.TrimSpace(v))
+		if key != "" && seen[key] {
+			out = append(out, strings.TrimSpace(v))
+			delete(seen, key)
+		}
+	}
+	return out
+}
+
+func listPreview(items []string) string {
+	if len(items) <= scoreMaxListedItems {
+		return strings.Join(items, ", ")
+	}
+	return strings.Join(items[:scoreMaxListedItems], ", ") +
+		fmt.Sprintf(" and %d more", len(items)-scoreMaxListedItems)
+}
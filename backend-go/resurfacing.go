@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"math"
+	"strings"
+)
+
+// ===== второй шанс для пропущенных анкет =====
+//
+// DISLIKED (свайп влево или разрыв матча) больше не скрывает анкету навсегда:
+// после DislikeCooldown она может вернуться в выдачу, но только если её
+// владелец с тех пор заметно поменял анкету ("User"."profileChangedAt").
+// Зритель может отключить это в настройках ("Preferences"."resurfacePassed").
+
+const (
+	// переезд дальше этого — заметное изменение
+	resurfaceMoveKm = 50.0
+	// косинус старого и нового текста ниже этого — текст переписан
+	resurfaceTextSimilarity = 0.5
+	// сколько хобби должно смениться
+	resurfaceHobbyChanges = 2
+)
+
+type bioSnapshot struct {
+	aboutMe *string
+	goals   *string
+	hobbies []string
+}
+
+// bioChangedSignificantly — новая цель, пара новых хобби или переписанный текст
+func bioChangedSignificantly(old, cur bioSnapshot) bool {
+	if !strings.EqualFold(strings.TrimSpace(deref(old.goals)), strings.TrimSpace(deref(cur.goals))) {
+		return true
+	}
+
+	shared := len(intersectFold(old.hobbies, cur.hobbies))
+	if (len(old.hobbies)-shared)+(len(cur.hobbies)-shared) >= resurfaceHobbyChanges {
+		return true
+	}
+
+	before, after := bioTermCounts(old.aboutMe, nil), bioTermCounts(cur.aboutMe, nil)
+	if len(before) == 0 && len(after) == 0 {
+		return false
+	}
+	return termCountCosine(before, after) < resurfaceTextSimilarity
+}
+
+func termCountCosine(a, b map[string]int) float64 {
+	var dot, na, nb float64
+	for term, x := range a {
+		na += float64(x * x)
+		dot += float64(x * b[term])
+	}
+	for _, y := range b {
+		nb += float64(y * y)
+	}
+	if na == 0 || nb == 0 {
+		return 0
+	}
+	return dot / math.Sqrt(na*nb)
+}
+
+// locationChangedSignificantly — впервые указали координаты или переехали далеко
+func locationChangedSignificantly(oldLat, oldLon, lat, lon *float64) bool {
+	if lat == nil || lon == nil {
+		return false
+	}
+	if oldLat == nil || oldLon == nil {
+		return true
+	}
+	return distanceKm(*oldLat, *oldLon, *lat, *lon) > resurfaceMoveKm
+}
+
+func markProfileChanged(ctx context.Context, q dbtx, userID int64) error {
+	_, err := q.Exec(ctx, `UPDATE "User" SET "profileChangedAt" = NOW() WHERE "id" = $1`, userID)
+	return err
+}
+
+func deref(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
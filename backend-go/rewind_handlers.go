@@ -0,0 +1,201 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// POST /connections/rewind
+// отменяет последний лайк/дизлайк, если он ещё не превратился в матч
+func handleRewindSwipe(w http.ResponseWriter, r *http.Request) {
+	userID, ok := getUserIDFromContext(r)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "Authentication required")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to start transaction")
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	// блокируем юзера, чтобы параллельные rewind не обошли лимит
+	var tmp int64
+	if err := tx.QueryRow(ctx, `SELECT "id" FROM "User" WHERE "id" = $1 FOR UPDATE`, userID).Scan(&tmp); err != nil {
+		writeError(w, http.StatusNotFound, "User not found")
+		return
+	}
+
+	dayStart, _ := localDay(userLocation(ctx, tx, userID), time.Now())
+	used, err := rewindsUsedSince(ctx, tx, userID, dayStart)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to check rewind limit")
+		return
+	}
+	limit := limitsFor(ctx, userID).rewindsDaily
+	if used >= limit {
+		writeError(w, http.StatusTooManyRequests, "Daily rewind limit reached")
+		return
+	}
+
+	// последний свайп — самое свежее наше действие
+	var (
+		toID       int64
+		lastStatus string
+		matched    bool
+		actedAt    time.Time
+	)
+	err = tx.QueryRow(ctx, `
+		SELECT "otherUserId", "action", "matchedAt" IS NOT NULL, COALESCE("actedAt", NOW())
+		FROM "ConnectionSide"
+		WHERE "userId" = $1
+		  AND "action" IS NOT NULL
+		ORDER BY "actedAt" DESC, "id" DESC
+		LIMIT 1
+	`, userID).Scan(&toID, &lastStatus, &matched, &actedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		writeError(w, http.StatusNotFound, "Nothing to rewind")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to load last swipe")
+		return
+	}
+	if matched || (lastStatus != connLiked && lastStatus != connDisliked) {
+		writeError(w, http.StatusConflict, "Last swipe can no longer be undone")
+		return
+	}
+
+	// под локом пары статус мог уже смениться (например, встречный лайк дал матч)
+	lastStatus, err = connectionsIn(tx).Undo(ctx, userID, toID)
+	if errors.Is(err, errInvalidTransition) || errors.Is(err, errConnectionNotFound) {
+		writeError(w, http.StatusConflict, "Last swipe can no longer be undone")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to undo swipe")
+		return
+	}
+	// вместе со свайпом откатываем всё, что он изменил: лайк в дневном лимите и оценку в рейтинге
+	if lastStatus == connLiked {
+		if err := refundDailyLike(ctx, tx, userID, actedAt); err != nil {
+			writeError(w, http.StatusInternalServerError, "Failed to refund like")
+			return
+		}
+	}
+	if err := revertRatingVote(ctx, tx, userID, toID); err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to update rating")
+		return
+	}
+	_, err = tx.Exec(ctx, `
+		INSERT INTO "Rewind" ("userId","targetUserId","status")
+		VALUES ($1,$2,$3)
+	`, userID, toID, lastStatus)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to record rewind")
+		return
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to undo swipe")
+		return
+	}
+
+	markRecommendationsStale(ctx, userID, toID)
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"rewound": map[string]interface{}{
+			"userId": toID,
+			"status": lastStatus,
+		},
+		"rewindsRemaining": limit - used - 1,
+	})
+}
+
+// сколько rewind юзер сделал начиная с since (начало его локальных суток)
+func rewindsUsedSince(ctx context.Context, q dbtx, userID int64, since time.Time) (int, error) {
+	var used int
+	err := q.QueryRow(ctx, `
+		SELECT COUNT(*)
+		FROM "Rewind"
+		WHERE "userId" = $1
+		  AND "createdAt" >= $2
+	`, userID, since).Scan(&used)
+	return used, err
+}
+
+// кандидаты, чей свайп отменили за последние сутки и которых ещё не свайпнули заново
+func rewoundCandidateIDs(ctx context.Context, userID int64) ([]int64, error) {
+	rows, err := db.Query(ctx, `
+		SELECT rw."targetUserId"
+		FROM "Rewind" rw
+		WHERE rw."userId" = $1
+		  AND rw."createdAt" > NOW() - INTERVAL '1 day'
+		  AND NOT EXISTS (
+			SELECT 1 FROM "ConnectionSide" cs
+			WHERE cs."userId" = $1
+			  AND cs."otherUserId" = rw."targetUserId"
+			  AND cs."action" IS NOT NULL
+		  )
+		GROUP BY rw."targetUserId"
+		ORDER BY MAX(rw."createdAt") DESC
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, pgx.RowTo[int64])
+}
+
+// pinRewoundCandidates ставит отменённых кандидатов в начало выдачи
+func pinRewoundCandidates(ctx context.Context, userID int64, results []scoredCandidate) ([]scoredCandidate, error) {
+	ids, err := rewoundCandidateIDs(ctx, userID)
+	if err != nil || len(ids) == 0 {
+		return results, err
+	}
+
+	excluded, err := excludedCandidateIDs(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	me, err := loadRecViewer(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	candidates, err := loadRecCandidates(ctx, userID, ids)
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[int64]*recProfile, len(candidates))
+	for i := range candidates {
+		byID[candidates[i].id] = &candidates[i]
+	}
+
+	now := time.Now()
+	weights := scorerForUser(userID)
+	pinned := make([]scoredCandidate, 0, len(ids)+len(results))
+	seen := map[int64]bool{}
+	for _, id := range ids {
+		c := byID[id]
+		if c == nil || excluded[id] {
+			continue
+		}
+		score, components := scoreCandidate(&me.recProfile, c, now, weights)
+		pinned = append(pinned, scoredCandidate{id: id, score: score, components: components})
+		seen[id] = true
+	}
+	for _, c := range results {
+		if !seen[c.id] {
+			pinned = append(pinned, c)
+		}
+	}
+	return pinned, nil
+}
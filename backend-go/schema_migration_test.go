@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// База в исходной схеме (testdata/schema_baseline.sql — схема до перехода на
+// строку на пару) должна мигрировать текущей db/schema.sql, как это делает
+// cmd/migrate. Всё делается в отдельной postgres-схеме, которая потом удаляется.
+func TestSchemaMigratesFromBaseline(t *testing.T) {
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	conn, err := pgx.Connect(ctx, url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close(context.Background())
+
+	ns := fmt.Sprintf("migrate_test_%d", time.Now().UnixNano())
+	if _, err := conn.Exec(ctx, `CREATE SCHEMA `+ns+`; SET search_path TO `+ns); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_, _ = conn.Exec(context.Background(), `DROP SCHEMA `+ns+` CASCADE`)
+	})
+
+	apply := func(path string) {
+		t.Helper()
+		sql, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := conn.Exec(ctx, string(sql)); err != nil {
+			t.Fatalf("apply %s: %v", path, err)
+		}
+	}
+
+	apply("testdata/schema_baseline.sql")
+	var ids [3]int64
+	for i := range ids {
+		err := conn.QueryRow(ctx, `
+			INSERT INTO "User" ("name","email","passwordHash","dateOfBirth","sex")
+			VALUES ('Legacy', $1, '-', '1995-01-01', 'OTHER')
+			RETURNING "id"
+		`, fmt.Sprintf("legacy-%d@example.test", i)).Scan(&ids[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	u1, u2, u3 := ids[0], ids[1], ids[2]
+	_, err = conn.Exec(ctx, `
+		INSERT INTO "Connection" ("fromUserId","toUserId","status","createdAt") VALUES
+			($1, $2, 'LIKED',    '2024-01-01T10:00:00Z'),
+			($2, $1, 'MATCHED',  '2024-01-02T10:00:00Z'),
+			($1, $3, 'DISLIKED', '2024-01-03T10:00:00Z')
+	`, u1, u2, u3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	apply("db/schema.sql")
+	// повторный прогон ничего не ломает
+	apply("db/schema.sql")
+
+	var legacy *string
+	if err := conn.QueryRow(ctx, `SELECT to_regclass('"ConnectionLegacy"')::text`).Scan(&legacy); err != nil {
+		t.Fatal(err)
+	}
+	if legacy != nil {
+		t.Fatal("ConnectionLegacy was not dropped")
+	}
+
+	var matched bool
+	var aAction, bAction string
+	err = conn.QueryRow(ctx, `
+		SELECT "matchedAt" IS NOT NULL, "aAction", "bAction"
+		FROM "Connection" WHERE "userAId" = $1 AND "userBId" = $2
+	`, u1, u2).Scan(&matched, &aAction, &bAction)
+	if err != nil {
+		t.Fatalf("matched pair: %v", err)
+	}
+	if !matched || aAction != connLiked || bAction != connLiked {
+		t.Fatalf("matched pair: matched=%v %s/%s, want a match with LIKED/LIKED", matched, aAction, bAction)
+	}
+
+	var disliked *string
+	var actedAt time.Time
+	err = conn.QueryRow(ctx, `
+		SELECT "aAction", "aActedAt"
+		FROM "Connection" WHERE "userAId" = $1 AND "userBId" = $2 AND "matchedAt" IS NULL AND "bAction" IS NULL
+	`, u1, u3).Scan(&disliked, &actedAt)
+	if err != nil {
+		t.Fatalf("one-sided pair: %v", err)
+	}
+	want := time.Date(2024, 1, 3, 10, 0, 0, 0, time.UTC)
+	if disliked == nil || *disliked != connDisliked || !actedAt.Equal(want) {
+		t.Fatalf("one-sided pair: %v at %s, want DISLIKED at %s", disliked, actedAt, want)
+	}
+
+	var transitions int
+	if err := conn.QueryRow(ctx, `SELECT COUNT(*) FROM "ConnectionTransition"`).Scan(&transitions); err != nil {
+		t.Fatal(err)
+	}
+	// LIKED, LIKED, MATCHED для матча и DISLIKED для второй пары
+	if transitions != 4 {
+		t.Fatalf("backfilled %d transitions, want 4", transitions)
+	}
+}
@@ -0,0 +1,328 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+)
+
+// ===== тарифы и подписки =====
+//
+// Подписку создаёт и меняет только обработка событий провайдера
+// (applyPaymentEvent): хендлеры ниже лишь просят провайдера купить или
+// отменить, а статус в базе обновится, когда придёт вебхук. Доступ к фичам
+// считается по оплаченному периоду — отменённая подписка работает до
+// "currentPeriodEnd", истёкшая без события тоже перестаёт давать права.
+
+const (
+	subscriptionActive   = "ACTIVE"
+	subscriptionCanceled = "CANCELED" // автопродление выключено, период ещё идёт
+	subscriptionExpired  = "EXPIRED"
+)
+
+var (
+	errUnknownPlan         = errors.New("unknown plan")
+	errUnknownSubscription = errors.New("unknown subscription")
+)
+
+type subscriptionPlan struct {
+	ID         string   `json:"id"`
+	Name       string   `json:"name"`
+	Features   []string `json:"features"`
+	PriceCents int      `json:"priceCents"`
+	Currency   string   `json:"currency"`
+	PeriodDays int      `json:"periodDays"`
+}
+
+type userSubscription struct {
+	ID                     int64      `json:"id"`
+	PlanID                 string     `json:"planId"`
+	Status                 string     `json:"status"`
+	Provider               string     `json:"provider"`
+	ProviderSubscriptionID string     `json:"-"`
+	CurrentPeriodStart     time.Time  `json:"currentPeriodStart"`
+	CurrentPeriodEnd       time.Time  `json:"currentPeriodEnd"`
+	CanceledAt             *time.Time `json:"canceledAt"`
+	CreatedAt              time.Time  `json:"createdAt"`
+}
+
+const subscriptionColumns = `"id","planId","status","provider","providerSubscriptionId",
+	"currentPeriodStart","currentPeriodEnd","canceledAt","createdAt"`
+
+func scanSubscription(row pgx.Row) (userSubscription, error) {
+	var s userSubscription
+	err := row.Scan(&s.ID, &s.PlanID, &s.Status, &s.Provider, &s.ProviderSubscriptionID,
+		&s.CurrentPeriodStart, &s.CurrentPeriodEnd, &s.CanceledAt, &s.CreatedAt)
+	return s, err
+}
+
+func scanPlan(row pgx.Row) (subscriptionPlan, error) {
+	var p subscriptionPlan
+	err := row.Scan(&p.ID, &p.Name, &p.Features, &p.PriceCents, &p.Currency, &p.PeriodDays)
+	return p, err
+}
+
+func loadPlans(ctx context.Context) ([]subscriptionPlan, error) {
+	rows, err := db.Query(ctx, `
+		SELECT "id","name","features","priceCents","currency","periodDays"
+		FROM "Plan"
+		WHERE "active"
+		ORDER BY "priceCents", "id"
+	`)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (subscriptionPlan, error) {
+		return scanPlan(row)
+	})
+}
+
+// loadPlan — тариф по id, в том числе снятый с продажи (для продлений)
+func loadPlan(ctx context.Context, q dbtx, id string) (subscriptionPlan, error) {
+	p, err := scanPlan(q.QueryRow(ctx, `
+		SELECT "id","name","features","priceCents","currency","periodDays"
+		FROM "Plan"
+		WHERE "id" = $1
+	`, id))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return p, errUnknownPlan
+	}
+	return p, err
+}
+
+// currentSubscription — подписка с неистёкшим периодом; nil, если её нет
+func currentSubscription(ctx context.Context, userID int64) (*userSubscription, error) {
+	s, err := scanSubscription(db.QueryRow(ctx, `
+		SELECT `+subscriptionColumns+`
+		FROM "Subscription"
+		WHERE "userId" = $1
+		  AND "status" <> 'EXPIRED'
+		  AND "currentPeriodEnd" > NOW()
+		ORDER BY "currentPeriodEnd" DESC
+		LIMIT 1
+	`, userID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// GET /plans
+func handleGetPlans(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	plans, err := loadPlans(ctx)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to load plans")
+		return
+	}
+	if plans == nil {
+		plans = []subscriptionPlan{}
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"plans": plans,
+	})
+}
+
+// writeMySubscription — текущая подписка и все доступные фичи (включая FREE_FEATURES и выданные вручную)
+func writeMySubscription(ctx context.Context, w http.ResponseWriter, userID int64, status int) {
+	sub, err := currentSubscription(ctx, userID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to load subscription")
+		return
+	}
+	set, err := userFeatures(ctx, userID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to load entitlements")
+		return
+	}
+	features := make([]string, 0, len(set))
+	for f := range set {
+		features = append(features, f)
+	}
+	sort.Strings(features)
+
+	writeJSON(w, status, map[string]interface{}{
+		"subscription": sub,
+		"features":     features,
+	})
+}
+
+// GET /me/subscription
+func handleGetMySubscription(w http.ResponseWriter, r *http.Request) {
+	userID, ok := getUserIDFromContext(r)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "Authentication required")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	writeMySubscription(ctx, w, userID, http.StatusOK)
+}
+
+// POST /me/subscription {planId}
+func handleCreateSubscription(w http.ResponseWriter, r *http.Request) {
+	userID, ok := getUserIDFromContext(r)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "Authentication required")
+		return
+	}
+
+	var body struct {
+		PlanID string `json:"planId"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid JSON")
+		return
+	}
+	body.PlanID = strings.TrimSpace(body.PlanID)
+	if body.PlanID == "" {
+		writeError(w, http.StatusBadRequest, "planId is required")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	plan, err := loadPlan(ctx, db, body.PlanID)
+	if errors.Is(err, errUnknownPlan) {
+		writeError(w, http.StatusNotFound, "Plan not found")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to load plan")
+		return
+	}
+
+	existing, err := currentSubscription(ctx, userID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to load subscription")
+		return
+	}
+	if existing != nil {
+		writeError(w, http.StatusConflict, "Already subscribed")
+		return
+	}
+
+	if _, err := defaultPaymentProvider.StartSubscription(ctx, userID, plan); err != nil {
+		writeError(w, http.StatusBadGateway, "Payment provider error")
+		return
+	}
+
+	// провайдер может прислать purchased позже — тогда подписки ещё нет
+	sub, err := currentSubscription(ctx, userID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to load subscription")
+		return
+	}
+	if sub == nil {
+		writeJSON(w, http.StatusAccepted, map[string]interface{}{
+			"pending": true,
+		})
+		return
+	}
+	writeMySubscription(ctx, w, userID, http.StatusCreated)
+}
+
+// DELETE /me/subscription — отмена автопродления, доступ остаётся до конца периода
+func handleCancelSubscription(w http.ResponseWriter, r *http.Request) {
+	userID, ok := getUserIDFromContext(r)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "Authentication required")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	sub, err := currentSubscription(ctx, userID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to load subscription")
+		return
+	}
+	if sub == nil {
+		writeError(w, http.StatusNotFound, "No active subscription")
+		return
+	}
+	if sub.Status == subscriptionCanceled {
+		writeError(w, http.StatusConflict, "Subscription is already canceled")
+		return
+	}
+
+	provider, ok := paymentProviders[sub.Provider]
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "Payment provider is not configured")
+		return
+	}
+	if err := provider.CancelSubscription(ctx, sub.ProviderSubscriptionID); err != nil {
+		writeError(w, http.StatusBadGateway, "Payment provider error")
+		return
+	}
+	writeMySubscription(ctx, w, userID, http.StatusOK)
+}
+
+// POST /me/subscription/simulate/{event} — renew|expire, только для провайдеров
+// с ручным управлением (fake): прогнать продление и истечение без ожидания.
+// Маршрут есть только при PAYMENTS_DEV_MODE.
+func handleSimulateSubscriptionEvent(w http.ResponseWriter, r *http.Request) {
+	userID, ok := getUserIDFromContext(r)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "Authentication required")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	sub, err := currentSubscription(ctx, userID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to load subscription")
+		return
+	}
+	if sub == nil {
+		writeError(w, http.StatusNotFound, "No active subscription")
+		return
+	}
+	sim, ok := paymentProviders[sub.Provider].(paymentSimulator)
+	if !ok {
+		writeError(w, http.StatusNotFound, "Provider does not support simulation")
+		return
+	}
+
+	switch chi.URLParam(r, "event") {
+	case "renew":
+		if sub.Status == subscriptionCanceled {
+			writeError(w, http.StatusConflict, "Canceled subscription does not renew")
+			return
+		}
+		plan, perr := loadPlan(ctx, db, sub.PlanID)
+		if perr != nil {
+			writeError(w, http.StatusInternalServerError, "Failed to load plan")
+			return
+		}
+		err = sim.SimulateRenewal(ctx, *sub, plan)
+	case "expire":
+		err = sim.SimulateExpiry(ctx, *sub)
+	default:
+		writeError(w, http.StatusBadRequest, "Unknown event, expected renew or expire")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to simulate event")
+		return
+	}
+	writeMySubscription(ctx, w, userID, http.StatusOK)
+}
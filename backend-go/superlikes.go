@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// ===== суперлайки =====
+//
+// Запас хранится в "Profile"."superLikes". Раз в SuperLikeRefillInterval он
+// доливается до SuperLikeRefillAmount (не суммируется), с extra_superlikes —
+// до PremiumSuperLikeRefillAmount. Доливка делается и воркером, и прямо при
+// списании — чтобы не ждать тика.
+
+// consumeSuperLike атомарно списывает один суперлайк и возвращает остаток
+func consumeSuperLike(ctx context.Context, q dbtx, userID, targetID int64) (int, error) {
+	var existing string
+	err := q.QueryRow(ctx, `
+		SELECT COALESCE("action", '')
+		FROM "ConnectionSide"
+		WHERE "userId" = $1 AND "otherUserId" = $2
+	`, userID, targetID).Scan(&existing)
+	if err == nil && existing == "SUPERLIKED" {
+		return 0, errAlreadySuperLiked
+	}
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return 0, err
+	}
+
+	var left int
+	err = q.QueryRow(ctx, `
+		WITH cur AS (
+			SELECT "userId",
+			       "superLikesRefilledAt" <= NOW() - make_interval(secs => $2) AS "due"
+			FROM "Profile"
+			WHERE "userId" = $1
+			FOR UPDATE
+		)
+		UPDATE "Profile" p SET
+			"superLikes" = CASE WHEN cur."due" THEN GREATEST(p."superLikes", $3) ELSE p."superLikes" END - 1,
+			"superLikesRefilledAt" = CASE WHEN cur."due" THEN NOW() ELSE p."superLikesRefilledAt" END
+		FROM cur
+		WHERE p."userId" = cur."userId"
+		  AND CASE WHEN cur."due" THEN GREATEST(p."superLikes", $3) ELSE p."superLikes" END > 0
+		RETURNING p."superLikes"
+	`, userID, appConfig.SuperLikeRefillInterval.Seconds(), limitsFor(ctx, userID).superLikeRefill).Scan(&left)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, errNoSuperLikesLeft
+	}
+	if err != nil {
+		return 0, err
+	}
+	return left, nil
+}
+
+func runSuperLikeRefillWorker(ctx context.Context, cfg Config) {
+	tick := cfg.SuperLikeRefillInterval
+	if tick > 10*time.Minute {
+		tick = 10 * time.Minute
+	}
+	ticker := time.NewTicker(tick)
+	defer ticker.Stop()
+
+	for {
+		rctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+		res, err := db.Exec(rctx, `
+			UPDATE "Profile" p SET
+				"superLikes" = GREATEST(p."superLikes", CASE
+					WHEN $4 OR EXISTS (
+						SELECT 1 FROM "ActiveEntitlement" e
+						WHERE e."userId" = p."userId" AND e."feature" = $5
+					) THEN $3
+					ELSE $2
+				END),
+				"superLikesRefilledAt" = NOW()
+			WHERE p."superLikesRefilledAt" <= NOW() - make_interval(secs => $1)
+		`, cfg.SuperLikeRefillInterval.Seconds(), cfg.SuperLikeRefillAmount,
+			max(cfg.SuperLikeRefillAmount, cfg.PremiumSuperLikeRefillAmount),
+			freeFeatureSet[featureExtraSuperLikes], featureExtraSuperLikes)
+		cancel()
+		if err != nil {
+			log.Printf("super-like refill: %v", err)
+		} else if n := res.RowsAffected(); n > 0 {
+			log.Printf("super-like refill: refilled %d profiles", n)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Тестам с базой нужен TEST_DATABASE_URL — отдельная, не боевая БД: схема
+// накатывается из db/schema.sql, юзеры создаются с уникальными email и не
+// удаляются. Без переменной такие тесты пропускаются.
+
+var (
+	testDBOnce sync.Once
+	testDBErr  error
+	testUserN  atomic.Int64
+)
+
+func setupTestDB(t *testing.T) context.Context {
+	t.Helper()
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+
+	testDBOnce.Do(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		pool, err := pgxpool.New(ctx, url)
+		if err != nil {
+			testDBErr = err
+			return
+		}
+		schema, err := os.ReadFile("db/schema.sql")
+		if err != nil {
+			testDBErr = err
+			return
+		}
+		if _, err := pool.Exec(ctx, string(schema)); err != nil {
+			testDBErr = fmt.Errorf("apply schema: %w", err)
+			return
+		}
+		db = pool
+	})
+	if testDBErr != nil {
+		t.Fatalf("test db: %v", testDBErr)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	t.Cleanup(cancel)
+	return ctx
+}
+
+func createTestUser(t *testing.T, ctx context.Context) int64 {
+	t.Helper()
+	email := fmt.Sprintf("test-%d-%d@example.test", time.Now().UnixNano(), testUserN.Add(1))
+	var id int64
+	err := db.QueryRow(ctx, `
+		INSERT INTO "User" ("name","email","passwordHash","dateOfBirth","sex")
+		VALUES ('Test', $1, '-', '1995-01-01', 'OTHER')
+		RETURNING "id"
+	`, email).Scan(&id)
+	if err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	return id
+}
@@ -0,0 +1,276 @@
+package main
+
+import (
+	"context"
+	"log"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// ===== текстовая похожесть aboutMe + goals =====
+//
+// Текст анкеты режется на токены, стоп-слова выкидываются, частоты слов
+// хранятся в "BioTerms". IDF считается в памяти по всем анкетам и
+// пересчитывается раз в textIndexRefresh; похожесть — косинус TF-IDF векторов.
+
+const (
+	textMinTokenLen   = 2
+	textMaxTerms      = 300 // больше разных слов в одной анкете не храним
+	textMinSimilarity = 0.05
+	textIndexRefresh  = 10 * time.Minute
+	textBackfillBatch = 200
+)
+
+// стоп-слова для языков из languagePool (en, et, ru, sv, fr, de, fi)
+var textStopWords = func() map[string]bool {
+	lists := []string{
+		// English
+		`a an and are as at be been but by can do does for from had has have he her his how i
+		 if in into is it its just like me my no not of on or our so than that the their them then
+		 there they this to too up us very was we were what when where which who will with would you your
+		 am im also about really love looking someone person people`,
+		// Estonian
+		`ja ei ka et see on ma mina sa sina ta tema me meie te teie nad nemad oli olen oled
+		 kui aga või ning mis kes kus siis veel väga oma selle seda ole pole ikka nii`,
+		// Russian
+		`и в во не что он на я с со как а то все она так его но да ты к у же вы за бы по только
+		 ее мне было вот от меня еще нет о из ему теперь когда даже ну ли если уже или ни быть был
+		 него до вас нибудь опять уж вам ведь там потом себя ничего ей может они тут где есть надо
+		 ней для мы тебя их чем была сам чтоб без будто чего раз тоже себе под будет ж тогда кто
+		 этот того потому этого какой совсем ним здесь этом один почти мой тем чтобы нее были куда
+		 зачем всех можно при об хоть после над больше тот через эти нас про всего них какая много
+		 разве три эту моя впрочем хорошо свою этой перед иногда лучше чуть том нельзя такой им
+		 более всегда конечно всю между люблю очень`,
+		// Swedish
+		`och det att i en jag hon som han på den med var sig för så till är men ett om hade de av
+		 icke mig du henne då sin nu har inte hans honom skulle hennes där min man ej vid kunde
+		 något från ut när efter upp vi dem vara vad över än dig kan sina här ha mot alla under
+		 någon eller allt mycket sedan ju denna själv detta åt utan varit hur ingen mitt ni bli
+		 blev oss din dessa några deras blir mina samma vilken er sådan vår blivit dess inom mellan`,
+		// French
+		`au aux avec ce ces dans de des du elle en et eux il je la le les leur lui ma mais me même
+		 mes moi mon ne nos notre nous on ou par pas pour qu que qui sa se ses son sur ta te tes
+		 toi ton tu un une vos votre vous c d j l m n s t y été être suis es est sommes êtes sont
+		 ai as avons avez ont aime très aussi`,
+		// German
+		`aber alle als also am an auch auf aus bei bin bis bist da damit dann das dass dein der
+		 des dich die dir du ein eine einem einen einer er es für hat hatte ich ihr im in ist ja
+		 kann mein mich mir mit nach nicht noch nur oder sehr sich sie sind so über um und uns
+		 unser von vor war was wenn wer wie wir zu zum zur gerne`,
+		// Finnish
+		`ja on ei se että en ole olen oli ovat olla mutta kun jos niin kuin myös vain tai minä
+		 sinä hän me te he mitä joka mikä tämä tuo nämä ne minun sinun hänen meidän teidän
+		 heidän minua sinua häntä siis sekä vaan kanssa paljon hyvin todella`,
+	}
+	m := map[string]bool{}
+	for _, list := range lists {
+		for _, w := range strings.Fields(list) {
+			m[w] = true
+		}
+	}
+	return m
+}()
+
+// tokenizeText — нижний регистр, разбиение по не-буквам/цифрам, без стоп-слов и чисел
+func tokenizeText(s string) []string {
+	fields := strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	out := fields[:0]
+	for _, f := range fields {
+		if len([]rune(f)) < textMinTokenLen || textStopWords[f] || isDigits(f) {
+			continue
+		}
+		out = append(out, f)
+	}
+	return out
+}
+
+func isDigits(s string) bool {
+	for _, r := range s {
+		if !unicode.IsDigit(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// bioTermCounts — частоты слов анкеты (aboutMe + goals)
+func bioTermCounts(aboutMe, goals *string) map[string]int {
+	var text []string
+	if aboutMe != nil {
+		text = append(text, *aboutMe)
+	}
+	if goals != nil {
+		text = append(text, *goals)
+	}
+	counts := map[string]int{}
+	for _, t := range tokenizeText(strings.Join(text, " ")) {
+		if _, ok := counts[t]; !ok && len(counts) >= textMaxTerms {
+			continue
+		}
+		counts[t]++
+	}
+	return counts
+}
+
+// indexBioTerms пересчитывает "BioTerms" юзера из текущего "Bio"
+func indexBioTerms(ctx context.Context, q dbtx, userID int64) error {
+	var aboutMe, goals *string
+	err := q.QueryRow(ctx, `SELECT "aboutMe","goals" FROM "Bio" WHERE "userId" = $1`, userID).Scan(&aboutMe, &goals)
+	if err != nil {
+		return err
+	}
+	_, err = q.Exec(ctx, `
+		INSERT INTO "BioTerms" ("userId","terms","updatedAt")
+		VALUES ($1,$2,NOW())
+		ON CONFLICT ("userId") DO UPDATE SET
+			"terms" = EXCLUDED."terms",
+			"updatedAt" = NOW()
+	`, userID, bioTermCounts(aboutMe, goals))
+	return err
+}
+
+// ===== IDF по всем анкетам =====
+
+type textIndex struct {
+	mu       sync.RWMutex
+	docs     int
+	docFreq  map[string]int
+	loadedAt time.Time
+}
+
+var bioTextIndex = &textIndex{docFreq: map[string]int{}}
+
+func (ix *textIndex) idf(term string) float64 {
+	// сглаженный idf, у неизвестных слов df = 0
+	return math.Log(float64(ix.docs+1)/float64(ix.docFreq[term]+1)) + 1
+}
+
+// vector строит нормированный TF-IDF вектор (tf сублинейный)
+func (ix *textIndex) vector(counts map[string]int) map[string]float64 {
+	if len(counts) == 0 {
+		return nil
+	}
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+
+	vec := make(map[string]float64, len(counts))
+	norm := 0.0
+	for term, n := range counts {
+		w := (1 + math.Log(float64(n))) * ix.idf(term)
+		vec[term] = w
+		norm += w * w
+	}
+	norm = math.Sqrt(norm)
+	for term := range vec {
+		vec[term] /= norm
+	}
+	return vec
+}
+
+func (ix *textIndex) reload(ctx context.Context) error {
+	var docs int
+	if err := db.QueryRow(ctx, `SELECT COUNT(*) FROM "BioTerms"`).Scan(&docs); err != nil {
+		return err
+	}
+	rows, err := db.Query(ctx, `
+		SELECT t.key, COUNT(*)
+		FROM "BioTerms" bt, jsonb_object_keys(bt."terms") AS t(key)
+		GROUP BY t.key
+	`)
+	if err != nil {
+		return err
+	}
+	docFreq := map[string]int{}
+	var term string
+	var n int
+	_, err = pgx.ForEachRow(rows, []any{&term, &n}, func() error {
+		docFreq[term] = n
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	ix.mu.Lock()
+	ix.docs, ix.docFreq, ix.loadedAt = docs, docFreq, time.Now()
+	ix.mu.Unlock()
+	return nil
+}
+
+// косинус двух нормированных векторов + общие слова по убыванию вклада
+func textSimilarity(a, b map[string]float64) (float64, []string) {
+	if len(a) > len(b) {
+		a, b = b, a
+	}
+	type shared struct {
+		term string
+		w    float64
+	}
+	var terms []shared
+	sim := 0.0
+	for term, wa := range a {
+		if wb, ok := b[term]; ok {
+			sim += wa * wb
+			terms = append(terms, shared{term, wa * wb})
+		}
+	}
+	sort.Slice(terms, func(i, j int) bool { return terms[i].w > terms[j].w })
+	out := make([]string, len(terms))
+	for i, t := range terms {
+		out[i] = t.term
+	}
+	return sim, out
+}
+
+// ===== фоновая индексация =====
+
+// refreshBioTextIndex доиндексирует анкеты без "BioTerms" (сид, старые юзеры)
+// и перечитывает IDF, если он устарел
+func refreshBioTextIndex(ctx context.Context) {
+	qctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	rows, err := db.Query(qctx, `
+		SELECT b."userId"
+		FROM "Bio" b
+		LEFT JOIN "BioTerms" bt ON bt."userId" = b."userId"
+		WHERE bt."userId" IS NULL
+		LIMIT $1
+	`, textBackfillBatch)
+	if err != nil {
+		log.Printf("text index: load unindexed bios: %v", err)
+		return
+	}
+	ids, err := pgx.CollectRows(rows, pgx.RowTo[int64])
+	if err != nil {
+		log.Printf("text index: scan unindexed bios: %v", err)
+		return
+	}
+	for _, id := range ids {
+		if err := indexBioTerms(qctx, db, id); err != nil {
+			log.Printf("text index: index user %d: %v", id, err)
+		}
+	}
+
+	bioTextIndex.mu.RLock()
+	due := time.Since(bioTextIndex.loadedAt) > textIndexRefresh
+	bioTextIndex.mu.RUnlock()
+	if !due && len(ids) == 0 {
+		return
+	}
+	if err := bioTextIndex.reload(qctx); err != nil {
+		log.Printf("text index: reload idf: %v", err)
+		return
+	}
+	if len(ids) > 0 {
+		log.Printf("text index: indexed %d bios", len(ids))
+	}
+}
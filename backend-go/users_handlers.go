@@ -24,22 +24,26 @@ func canViewUserDetails(ctx context.Context, viewerID, targetID int64) (bool, er
 		return true, nil
 	}
 
+	// блок в любую сторону — профиль скрыт
+	blocked, err := isBlockedBetween(ctx, db, viewerID, targetID)
+	if err != nil {
+		return false, err
+	}
+	if blocked {
+		return false, nil
+	}
+
 	// есть ли хоть какая-то нененавистная связь
-	var status string
-	err := db.QueryRow(ctx, `
-		SELECT "status"
-		FROM "Connection"
-		WHERE (
-			("fromUserId" = $1 AND "toUserId" = $2) OR
-			("fromUserId" = $2 AND "toUserId" = $1)
-		)
-		LIMIT 1
-	`, viewerID, targetID).Scan(&status)
-	if err == nil {
-		// если существует и не DISLIKED — можно смотреть
-		if status != "DISLIKED" {
-			return true, nil
-		}
+	var friendly bool
+	err = db.QueryRow(ctx, `
+		SELECT "matchedAt" IS NOT NULL
+		    OR (COALESCE("action", '') <> 'DISLIKED' AND COALESCE("otherAction", '') <> 'DISLIKED')
+		FROM "ConnectionSide"
+		WHERE "userId" = $1 AND "otherUserId" = $2
+	`, viewerID, targetID).Scan(&friendly)
+	if err == nil && friendly {
+		// связь есть и никто никого не отверг — можно смотреть
+		return true, nil
 	}
 
 	// иначе — проверяем, могли бы они быть рекоммендацией (похожая логика на /recommendations)
@@ -11,6 +11,7 @@ import (
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/gorilla/websocket"
+	"github.com/jackc/pgx/v5"
 )
 
 // ===== WebSocket модели =====
@@ -18,6 +19,26 @@ import (
 type wsClient struct {
 	userID int64
 	conn   *websocket.Conn
+	// gorilla/websocket не допускает параллельной записи в одно соединение
+	writeMu sync.Mutex
+}
+
+func (c *wsClient) write(data []byte) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	return c.conn.WriteMessage(websocket.TextMessage, data)
+}
+
+// sendJSON — кадр только этому соединению (ответы на его же запросы)
+func (c *wsClient) sendJSON(payload wsOutgoing) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		log.Println("ws sendJSON marshal error:", err)
+		return
+	}
+	if err := c.write(data); err != nil {
+		log.Println("ws sendJSON write error:", err)
+	}
 }
 
 type wsHub struct {
@@ -29,6 +50,10 @@ var hub = &wsHub{
 	byUser: make(map[int64]map[*wsClient]struct{}),
 }
 
+// типы: new_message / typing / presence / superlike / moderation_warning /
+// match (Partner + ChatID) / like_received (Request) / unmatched (UserID + ChatID) /
+// chat_updated, chat_removed (ChatID + FromUserID) — состав или название группы /
+// ack (ClientID + Message), send_error (ClientID + Error + Status) — ответы на send_message
 type wsOutgoing struct {
 	Type       string               `json:"type"`
 	ChatID     int64                `json:"chatId,omitempty"`
@@ -37,6 +62,28 @@ type wsOutgoing struct {
 	Online     bool                 `json:"online,omitempty"`
 	Message    *chatMessageResponse `json:"message,omitempty"`
 	Typing     bool                 `json:"typing,omitempty"`
+	Text       string               `json:"text,omitempty"`
+	Partner    *wsUserSummary       `json:"partner,omitempty"`
+	Request    *wsConnectionRequest `json:"request,omitempty"`
+	ClientID   string               `json:"clientId,omitempty"`
+	Error      string               `json:"error,omitempty"`
+	Status     int                  `json:"status,omitempty"`
+	Locked     bool                 `json:"locked,omitempty"`
+}
+
+// краткая карточка второго участника для события match
+type wsUserSummary struct {
+	ID        int64   `json:"id"`
+	Name      string  `json:"name"`
+	AvatarURL *string `json:"avatarUrl"`
+}
+
+// то же, что элемент GET /connections/requests
+type wsConnectionRequest struct {
+	ID         int64  `json:"id"`
+	FromUserID int64  `json:"fromUserId"`
+	ToUserID   int64  `json:"toUserId"`
+	Status     string `json:"status"`
 }
 
 // ===== hub helpers =====
@@ -88,17 +135,49 @@ func wsSendToUser(userID int64, payload wsOutgoing) {
 	}
 
 	for _, c := range clients {
-		if err := c.conn.WriteMessage(websocket.TextMessage, data); err != nil {
+		if err := c.write(data); err != nil {
 			log.Println("wsSendToUser write error:", err)
 		}
 	}
 }
 
-// broadcast presence всем подключённым
+// wsFanOut шлёт событие участникам чата, кроме отправителя и тех, у кого с ним блок
+func wsFanOut(ctx context.Context, senderID int64, userIDs []int64, payload wsOutgoing) {
+	blocked, err := blockedWith(ctx, senderID)
+	if err != nil {
+		log.Println("wsFanOut blocks error:", err)
+		return
+	}
+	for _, id := range userIDs {
+		if id != senderID && !blocked[id] {
+			wsSendToUser(id, payload)
+		}
+	}
+}
+
+// есть ли у юзера открытый сокет
+func isUserOnline(userID int64) bool {
+	hub.mu.RLock()
+	defer hub.mu.RUnlock()
+	return len(hub.byUser[userID]) > 0
+}
+
+// broadcast presence всем подключённым, кроме тех, с кем есть блок или анматч
 func wsBroadcastPresence(userID int64, online bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	blocked, err := presenceHiddenWith(ctx, userID)
+	cancel()
+	if err != nil {
+		log.Println("wsBroadcastPresence blocks error:", err)
+		return
+	}
+
 	hub.mu.RLock()
 	clients := make([]*wsClient, 0)
-	for _, conns := range hub.byUser {
+	for id, conns := range hub.byUser {
+		if blocked[id] {
+			continue
+		}
 		for c := range conns {
 			clients = append(clients, c)
 		}
@@ -117,7 +196,7 @@ func wsBroadcastPresence(userID int64, online bool) {
 	}
 
 	for _, c := range clients {
-		if err := c.conn.WriteMessage(websocket.TextMessage, data); err != nil {
+		if err := c.write(data); err != nil {
 			log.Println("wsBroadcastPresence write error:", err)
 		}
 	}
@@ -170,6 +249,14 @@ func handleWS(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
+	// забаненные и приостановленные не подключаются
+	ctx, cancel := context.WithTimeout(r.Context(), 3*time.Second)
+	reason, err := accountRestriction(ctx, userID)
+	cancel()
+	if err != nil || reason != "" {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
 
 	conn, err := wsUpgrader.Upgrade(w, r, nil)
 	if err != nil {
@@ -184,7 +271,7 @@ func handleWS(w http.ResponseWriter, r *http.Request) {
 	hub.addClient(client)
 	wsBroadcastPresence(userID, true)
 
-	// читаем входящие сообщения (typing)
+	// читаем входящие кадры (typing, send_message)
 	go func() {
 		defer func() {
 			hub.removeClient(client)
@@ -200,9 +287,11 @@ func handleWS(w http.ResponseWriter, r *http.Request) {
 			}
 
 			var incoming struct {
-				Type   string `json:"type"`
-				ChatID int64  `json:"chatId"`
-				Typing bool   `json:"typing"`
+				Type     string `json:"type"`
+				ChatID   int64  `json:"chatId"`
+				Typing   bool   `json:"typing"`
+				Content  string `json:"content"`
+				ClientID string `json:"clientId"`
 			}
 			if err := json.Unmarshal(data, &incoming); err != nil {
 				continue
@@ -214,29 +303,165 @@ func handleWS(w http.ResponseWriter, r *http.Request) {
 					continue
 				}
 
-				// находим второго участника чата
+				// остальные участники, если юзер сам в чате; в закрытом чате typing не шлём
 				ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-				var otherID int64
-				err := db.QueryRow(ctx, `
-					SELECT "userId"
-					FROM "ChatUser"
-					WHERE "chatId" = $1 AND "userId" <> $2
-					LIMIT 1
-				`, incoming.ChatID, userID).Scan(&otherID)
-				cancel()
-				if err != nil || otherID <= 0 {
+				rows, err := db.Query(ctx, `
+					SELECT cu."userId"
+					FROM "ChatUser" cu
+					JOIN "Chat" c ON c."id" = cu."chatId" AND c."closedAt" IS NULL
+					WHERE cu."chatId" = $1 AND cu."userId" <> $2
+					  AND EXISTS (
+						SELECT 1 FROM "ChatUser" me
+						WHERE me."chatId" = $1 AND me."userId" = $2 AND me."hiddenAt" IS NULL
+					  )
+				`, incoming.ChatID, userID)
+				var others []int64
+				if err == nil {
+					others, err = pgx.CollectRows(rows, pgx.RowTo[int64])
+				}
+				if err != nil || len(others) == 0 {
+					cancel()
 					continue
 				}
 
-				wsSendToUser(otherID, wsOutgoing{
+				wsFanOut(ctx, userID, others, wsOutgoing{
 					Type:       "typing",
 					ChatID:     incoming.ChatID,
 					FromUserID: userID,
 					Typing:     incoming.Typing,
 				})
+				cancel()
+			case "send_message":
+				wsHandleSendMessage(client, incoming.ChatID, incoming.Content, incoming.ClientID)
 			default:
 				// других типов пока нет
 			}
 		}
 	}()
 }
+
+// wsHandleSendMessage — send_message: тот же путь, что POST /chats/{id}/messages.
+// Отправителю — ack с сохранённым сообщением или send_error, остальным — new_message.
+func wsHandleSendMessage(c *wsClient, chatID int64, content, clientID string) {
+	fail := func(status int, msg string) {
+		c.sendJSON(wsOutgoing{Type: "send_error", ChatID: chatID, ClientID: clientID, Error: msg, Status: status})
+	}
+	if clientID == "" {
+		fail(http.StatusBadRequest, "clientId is required")
+		return
+	}
+	if chatID <= 0 {
+		fail(http.StatusBadRequest, "Invalid chat id")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// статус аккаунта мог смениться после подключения
+	if reason, err := accountRestriction(ctx, c.userID); err != nil || reason != "" {
+		fail(http.StatusForbidden, "Account is restricted")
+		return
+	}
+
+	sent, err := sendChatMessage(ctx, c.userID, chatID, content, clientID)
+	if err != nil {
+		status, msg := chatSendErrorStatus(err)
+		if status == http.StatusInternalServerError {
+			log.Printf("ws send message to chat %d: %v", chatID, err)
+		}
+		fail(status, msg)
+		return
+	}
+
+	msg := sent.message
+	c.sendJSON(wsOutgoing{Type: "ack", ChatID: chatID, ClientID: clientID, Message: &msg})
+	fanOutChatMessage(ctx, c.userID, sent)
+}
+
+// ===== события матчей и лайков =====
+
+func loadUserSummaries(ctx context.Context, ids ...int64) (map[int64]*wsUserSummary, error) {
+	rows, err := db.Query(ctx, `
+		SELECT u."id", u."name",
+		       (SELECT p."url" FROM "Photo" p WHERE p."userId" = u."id" ORDER BY p."id" LIMIT 1)
+		FROM "User" u
+		WHERE u."id" = ANY($1)
+	`, ids)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := make(map[int64]*wsUserSummary, len(ids))
+	for rows.Next() {
+		var s wsUserSummary
+		if err := rows.Scan(&s.ID, &s.Name, &s.AvatarURL); err != nil {
+			return nil, err
+		}
+		out[s.ID] = &s
+	}
+	return out, rows.Err()
+}
+
+// wsNotifyMatch шлёт обоим match с карточкой партнёра и id чата
+func wsNotifyMatch(ctx context.Context, user1, user2, chatID int64) {
+	users, err := loadUserSummaries(ctx, user1, user2)
+	if err != nil {
+		log.Println("wsNotifyMatch load users error:", err)
+		return
+	}
+	for _, pair := range [][2]int64{{user1, user2}, {user2, user1}} {
+		partner := users[pair[1]]
+		if partner == nil {
+			continue
+		}
+		wsSendToUser(pair[0], wsOutgoing{
+			Type:    "match",
+			ChatID:  chatID,
+			UserID:  partner.ID,
+			Partner: partner,
+		})
+	}
+}
+
+// wsNotifyUnmatched — партнёру: матч разорван, чаты закрыты; обоим — presence
+// offline друг о друге, чтобы клиенты сразу спрятали статус
+func wsNotifyUnmatched(userID, partnerID int64, chatIDs []int64) {
+	var chatID int64
+	if len(chatIDs) > 0 {
+		chatID = chatIDs[0]
+	}
+	wsSendToUser(partnerID, wsOutgoing{
+		Type:   "unmatched",
+		UserID: userID,
+		ChatID: chatID,
+	})
+	wsSendToUser(partnerID, wsOutgoing{Type: "presence", UserID: userID, Online: false})
+	wsSendToUser(userID, wsOutgoing{Type: "presence", UserID: partnerID, Online: false})
+}
+
+// wsNotifyLikeReceived — новый входящий лайк/суперлайк для списка запросов.
+// Автора обычного лайка видят только с featureLikesYou, остальным — без него.
+func wsNotifyLikeReceived(ctx context.Context, res connectionActionResult) {
+	if res.Status != connSuperLiked {
+		entitled, err := HasEntitlement(ctx, res.ToUserID, featureLikesYou)
+		if err != nil {
+			log.Printf("like_received %d -> %d: check entitlement: %v", res.FromUserID, res.ToUserID, err)
+		}
+		if !entitled {
+			wsSendToUser(res.ToUserID, wsOutgoing{Type: "like_received", Locked: true})
+			return
+		}
+	}
+	wsSendToUser(res.ToUserID, wsOutgoing{
+		Type:       "like_received",
+		FromUserID: res.FromUserID,
+		Request: &wsConnectionRequest{
+			ID:         res.ID,
+			FromUserID: res.FromUserID,
+			ToUserID:   res.ToUserID,
+			Status:     res.Status,
+		},
+	})
+}
@@ -321,11 +321,52 @@ export async function apiGetUserProfile(id: number): Promise<ApiUserProfile> {
 
 
 
-// GET /connections { connections: number[] }
-export async function apiGetConnectionsIds(): Promise<number[]> {
+// GET /connections?sort=&limit=&cursor= -> { connections: ApiConnectionCard[], nextCursor }
+export type ApiConnectionCard = {
+  connectionId: number;
+  userId: number;
+  name: string;
+  avatarUrl: string | null;
+  matchedAt: string;
+  chatId: number | null;
+  lastMessage: { content: string; senderId: number; timestamp: string } | null;
+  online: boolean;
+};
+
+export type ApiPage<T> = {
+  items: T[];
+  nextCursor: string | null;
+};
+
+// walks every page of a cursor-paginated list
+async function fetchAllPages<T>(
+  load: (cursor: string | null) => Promise<ApiPage<T>>
+): Promise<T[]> {
+  const all: T[] = [];
+  let cursor: string | null = null;
+  do {
+    const page: ApiPage<T> = await load(cursor);
+    all.push(...page.items);
+    cursor = page.nextCursor;
+  } while (cursor);
+  return all;
+}
+
+export async function apiGetConnections(
+  params: {
+    sort?: "recent" | "activity" | "name";
+    limit?: number;
+    cursor?: string | null;
+  } = {}
+): Promise<ApiPage<ApiConnectionCard>> {
   const headers = getAuthHeaders();
 
-  const res = await fetch(`${API_URL}/connections`, {
+  const query = new URLSearchParams();
+  if (params.sort) query.set("sort", params.sort);
+  if (params.limit) query.set("limit", String(params.limit));
+  if (params.cursor) query.set("cursor", params.cursor);
+
+  const res = await fetch(`${API_URL}/connections?${query}`, {
     method: "GET",
     headers,
   });
@@ -334,33 +375,59 @@ export async function apiGetConnectionsIds(): Promise<number[]> {
     throw new Error("Failed to load connections");
   }
 
-  const data: { connections: number[] } = await res.json();
-  return data.connections ?? [];
+  const data: {
+    connections: ApiConnectionCard[];
+    nextCursor: string | null;
+  } = await res.json();
+  return { items: data.connections ?? [], nextCursor: data.nextCursor ?? null };
+}
+
+// all matches, across every page
+export async function apiGetAllConnections(
+  sort: "recent" | "activity" | "name" = "recent"
+): Promise<ApiConnectionCard[]> {
+  return fetchAllPages((cursor) =>
+    apiGetConnections({ sort, limit: 100, cursor })
+  );
 }
 
-// GET /connections/requests -> { requests: [{ id, fromUserId, status }] }
+// GET /connections/requests?sort=&limit=&cursor= -> { requests: [...], nextCursor }
 export type ApiConnectionRequest = {
   id: number;
   fromUserId: number;
+  toUserId: number;
   status: "LIKED" | "SUPERLIKED" | "PENDING" | "MATCHED" | "DISLIKED";
+  name: string;
+  avatarUrl: string | null;
+  likedAt: string;
+  online: boolean;
 };
 
+// all incoming likes, across every page
 export async function apiGetConnectionRequests(): Promise<
   ApiConnectionRequest[]
 > {
   const headers = getAuthHeaders();
 
-  const res = await fetch(`${API_URL}/connections/requests`, {
-    method: "GET",
-    headers,
-  });
+  return fetchAllPages(async (cursor) => {
+    const query = new URLSearchParams({ limit: "100" });
+    if (cursor) query.set("cursor", cursor);
 
-  if (!res.ok) {
-    throw new Error("Failed to load connection requests");
-  }
+    const res = await fetch(`${API_URL}/connections/requests?${query}`, {
+      method: "GET",
+      headers,
+    });
 
-  const data: { requests: ApiConnectionRequest[] } = await res.json();
-  return data.requests ?? [];
+    if (!res.ok) {
+      throw new Error("Failed to load connection requests");
+    }
+
+    const data: {
+      requests: ApiConnectionRequest[];
+      nextCursor: string | null;
+    } = await res.json();
+    return { items: data.requests ?? [], nextCursor: data.nextCursor ?? null };
+  });
 }
 
 // POST /connections/:id/like
@@ -13,7 +13,7 @@ import "../styles/friends.css";
 
 import {
   apiGetConnectionRequests,
-  apiGetConnectionsIds,
+  apiGetAllConnections,
   apiAcceptRequest,
   apiRejectRequest,
   apiGetUser,
@@ -78,15 +78,15 @@ export default function Friends() {
         setLoading(true);
         setError(null);
 
-        const [requestsRaw, connectionsIds] = await Promise.all([
-          apiGetConnectionRequests(), // [{ id, fromUserId, status }]
-          apiGetConnectionsIds(), // [userId, userId...]
+        const [requestsRaw, connections] = await Promise.all([
+          apiGetConnectionRequests(), // [{ id, fromUserId, status, ... }]
+          apiGetAllConnections(), // [{ connectionId, userId, name, ... }]
         ]);
 
         const requestUserIds = [
           ...new Set(requestsRaw.map((r) => r.fromUserId)),
         ];
-        const friendUserIds = [...new Set(connectionsIds)];
+        const friendUserIds = [...new Set(connections.map((c) => c.userId))];
 
         const loadProfiles = async (ids: number[]): Promise<FriendProfile[]> =>
           Promise.all(